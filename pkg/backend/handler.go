@@ -25,6 +25,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/auth"
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/mailer"
 
 	"google.golang.org/appengine"
 
@@ -53,6 +54,21 @@ func UserGet(w http.ResponseWriter, r *http.Request) *AppError {
 	return nil
 }
 
+// QueryUsage reports the bytes scanned by BigQuery per day for the last ?days=N days
+// Requires admin access
+func QueryUsage(w http.ResponseWriter, r *http.Request) *AppError {
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	usage, err := github.GetQueryUsage(days)
+	if err != nil {
+		return appErrorf(err, "Couldn't get BigQuery usage")
+	}
+	writeJSON(w, usage)
+	return nil
+}
+
 // GetSubs retrieves subscriptions for a given user
 func GetSubs(w http.ResponseWriter, r *http.Request) *AppError {
 
@@ -90,6 +106,7 @@ func GetRepos(w http.ResponseWriter, r *http.Request) *AppError {
 }
 
 // AddSubs retrieves subscriptions for a given user
+// The repo form value can be a pattern such as "myorg/*" to subscribe to many repos
 func AddSubs(w http.ResponseWriter, r *http.Request) *AppError {
 
 	ctx := appengine.NewContext(r)
@@ -98,7 +115,13 @@ func AddSubs(w http.ResponseWriter, r *http.Request) *AppError {
 		return appErrorf(err, "No such user: %v", user.Login)
 	}
 	repo := r.FormValue("repo")
-	if err = github.UpdateRepo(ctx, repo); err != nil {
+	if github.IsRepoPattern(repo) {
+		// Patterns are resolved when digests are sent, so only check that the owner exists
+		if _, err = github.ExpandRepos(ctx, repo); err != nil {
+			log.Printf("Github API Fetch error: %v", err)
+			return appErrorf(err, "Couldn't subscribe to repos: %v", repo)
+		}
+	} else if err = github.UpdateRepo(ctx, repo); err != nil {
 		log.Printf("Github API Fetch error: %v", err)
 		return appErrorf(err, "Couldn't subscribe to repo: %v", repo)
 	}
@@ -113,6 +136,8 @@ func AddSubs(w http.ResponseWriter, r *http.Request) *AppError {
 }
 
 // UpdateSub updates subscriptions for a given user
+// The optional filter form value holds the JSON encoded github.Filter for the subscription,
+// and the optional schedule form value the cron style schedule for Scheduled digests
 func UpdateSub(w http.ResponseWriter, r *http.Request) *AppError {
 
 	user, err := getAuthenticatedUser(w, r)
@@ -121,12 +146,31 @@ func UpdateSub(w http.ResponseWriter, r *http.Request) *AppError {
 	}
 	repo := r.FormValue("repo")
 	defaultEmail := r.FormValue("defaultEmail")
+	// An empty source resets the subscription to the default source
+	source, setSource := r.FormValue("source"), len(r.Form["source"]) != 0
+	if !github.ValidSource(source) {
+		return appErrorf(fmt.Errorf("invalid source: %v", source),
+			"Couldn't update source for repo: %v", repo)
+	}
+	schedule := r.FormValue("schedule")
+	if len(schedule) != 0 {
+		if _, err := github.ParseSchedule(schedule); err != nil {
+			return appErrorf(err, "Couldn't update schedule for repo: %v", repo)
+		}
+	}
 	settings := []byte(r.FormValue("settings"))
 	preferences := github.EmailPreference{}
 	err = json.Unmarshal(settings, &preferences)
 	if err != nil {
 		return appErrorf(err, "Couldn't get settings for repo: %v", repo)
 	}
+	var filter *github.Filter
+	if f := r.FormValue("filter"); len(f) != 0 {
+		filter = &github.Filter{}
+		if err = json.Unmarshal([]byte(f), filter); err != nil {
+			return appErrorf(err, "Couldn't get filter for repo: %v", repo)
+		}
+	}
 	subs, _ := user.GetSubscriptions(repo)
 	if len(subs) == 1 {
 		sub := subs[0]
@@ -134,6 +178,15 @@ func UpdateSub(w http.ResponseWriter, r *http.Request) *AppError {
 		if len(defaultEmail) != 0 {
 			sub.DefaultEmail = defaultEmail
 		}
+		if setSource {
+			sub.Source = source
+		}
+		if len(schedule) != 0 {
+			sub.Schedule = schedule
+		}
+		if filter != nil {
+			sub.Filter = *filter
+		}
 		if err := user.UpdateSubscription(repo, &sub); err == nil {
 			writeJSON(w, sub)
 			return nil
@@ -144,6 +197,46 @@ func UpdateSub(w http.ResponseWriter, r *http.Request) *AppError {
 
 }
 
+// ImportCandidates lists the repos that a user watches or starred on GitHub for bulk
+// subscription, and the repos of the user's organizations with ?orgs=true
+func ImportCandidates(w http.ResponseWriter, r *http.Request) *AppError {
+
+	ctx := appengine.NewContext(r)
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	candidates, err := user.ImportCandidates(ctx, r.FormValue("orgs") == "true")
+	if err != nil {
+		return appErrorf(err, "Couldn't list repos for user: %v", user.Login)
+	}
+	writeJSON(w, candidates)
+	return nil
+}
+
+// ImportSubs subscribes a user to the JSON list of repos in the repos form value, with
+// the email preferences in settings or the default preferences
+func ImportSubs(w http.ResponseWriter, r *http.Request) *AppError {
+
+	ctx := appengine.NewContext(r)
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	var repos []string
+	if err := json.Unmarshal([]byte(r.FormValue("repos")), &repos); err != nil {
+		return appErrorf(err, "Couldn't get repos to import")
+	}
+	preferences := github.NewPreference()
+	if settings := r.FormValue("settings"); len(settings) != 0 {
+		if err := json.Unmarshal([]byte(settings), &preferences); err != nil {
+			return appErrorf(err, "Couldn't get settings for import")
+		}
+	}
+	writeJSON(w, user.Import(ctx, repos, preferences, r.FormValue("defaultEmail")))
+	return nil
+}
+
 // DelSubs retrieves subscriptions for a given user
 func DelSubs(w http.ResponseWriter, r *http.Request) *AppError {
 
@@ -160,6 +253,28 @@ func DelSubs(w http.ResponseWriter, r *http.Request) *AppError {
 	return nil
 }
 
+// DigestPreview renders the digests of the frequency form value, such as "weekly", that
+// the user would get now, without sending them or recording notifications
+func DigestPreview(w http.ResponseWriter, r *http.Request) *AppError {
+
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	// Load the subscriptions and delivery preferences of the user
+	user, err = github.FindUserByLogin(user.Login)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	ctx := appengine.NewContext(r)
+	digests, err := mailer.PreviewDigests(ctx, user, r.FormValue("frequency"))
+	if err != nil {
+		return appErrorf(err, "Couldn't preview digest: %v", r.FormValue("frequency"))
+	}
+	writeJSON(w, digests)
+	return nil
+}
+
 // UserAdd handles creation of a new user
 func UserAdd(w http.ResponseWriter, r *http.Request) *AppError {
 	var user github.User
@@ -177,7 +292,8 @@ func UserAdd(w http.ResponseWriter, r *http.Request) *AppError {
 	return nil
 }
 
-// UserUpdate updates a user's preferences
+// UserUpdate updates a user's preferences, the default email, the time zone of digests with
+// timezone, which is empty for Pacific time, and the hour they are sent at with deliveryHour
 func UserUpdate(w http.ResponseWriter, r *http.Request) *AppError {
 
 	user, err := getAuthenticatedUser(w, r)
@@ -187,6 +303,23 @@ func UserUpdate(w http.ResponseWriter, r *http.Request) *AppError {
 	if email := r.FormValue("email"); len(email) != 0 {
 		user.Email = email
 	}
+	if _, ok := r.Form["timezone"]; ok {
+		timezone := r.FormValue("timezone")
+		if len(timezone) != 0 {
+			if err := github.ValidTimezone(timezone); err != nil {
+				return appErrorf(err, "Couldn't update time zone for user: %v", user.Login)
+			}
+		}
+		user.Timezone = timezone
+	}
+	if hour := r.FormValue("deliveryHour"); len(hour) != 0 {
+		h, err := strconv.Atoi(hour)
+		if err != nil || h < 0 || h > 23 {
+			return appErrorf(fmt.Errorf("invalid hour: %v", hour),
+				"Couldn't update delivery hour for user: %v", user.Login)
+		}
+		user.DeliveryHour = h
+	}
 	w.Header().Set("Content-Type", "application/json")
 	response, _ := json.Marshal(user)
 	w.Write([]byte(response))
@@ -0,0 +1,264 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+
+	"google.golang.org/appengine"
+)
+
+// GetTeams retrieves the teams that a user is a member of
+func GetTeams(w http.ResponseWriter, r *http.Request) *AppError {
+
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	teams, err := user.GetTeams()
+	if err != nil {
+		return appErrorf(err, "Couldn't get teams for user: %v", user.Login)
+	}
+	writeJSON(w, teams)
+	return nil
+}
+
+// AddTeam creates a team with the user as its owner
+func AddTeam(w http.ResponseWriter, r *http.Request) *AppError {
+
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", user.Login)
+	}
+	team, err := github.CreateTeam(r.FormValue("name"), r.FormValue("email"), user)
+	if err != nil {
+		return appErrorf(err, "Couldn't create team: %v", r.FormValue("name"))
+	}
+	writeJSON(w, team)
+	return nil
+}
+
+// UpdateTeam changes the name and email of a team, requires an owner
+func UpdateTeam(w http.ResponseWriter, r *http.Request) *AppError {
+
+	_, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	if name := r.FormValue("name"); len(name) != 0 {
+		team.Name = name
+	}
+	if _, ok := r.Form["email"]; ok {
+		team.Email = r.FormValue("email")
+	}
+	if err := team.Update(); err != nil {
+		return appErrorf(err, "Couldn't update team: %v", team.Name)
+	}
+	writeJSON(w, team)
+	return nil
+}
+
+// DelTeam removes a team and its subscriptions, requires an owner
+func DelTeam(w http.ResponseWriter, r *http.Request) *AppError {
+
+	_, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	err := team.Remove()
+	if err != nil {
+		return appErrorf(err, "Couldn't remove team: %v", team.Name)
+	}
+	writeJSON(w, status{err, "ok", 200})
+	return nil
+}
+
+// AddTeamMember adds the user with the login form value to a team, as an owner with
+// owner=true, requires an owner
+func AddTeamMember(w http.ResponseWriter, r *http.Request) *AppError {
+
+	_, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	member, err := github.FindUserByLogin(r.FormValue("login"))
+	if err != nil {
+		return appErrorf(err, "No such user: %v", r.FormValue("login"))
+	}
+	if err := team.AddMember(member, r.FormValue("owner") == "true"); err != nil {
+		return appErrorf(err, "Couldn't add %v to team: %v", member.Login, team.Name)
+	}
+	writeJSON(w, team)
+	return nil
+}
+
+// DelTeamMember removes the user with the login form value from a team, requires an
+// owner unless users remove themselves
+func DelTeamMember(w http.ResponseWriter, r *http.Request) *AppError {
+
+	user, team, e := getTeam(w, r)
+	if e != nil {
+		return e
+	}
+	login := r.FormValue("login")
+	if login != user.Login && !team.IsOwner(user) {
+		return appErrorf(fmt.Errorf("%v is not an owner", user.Login),
+			"Couldn't change team: %v", team.Name)
+	}
+	member, err := github.FindUserByLogin(login)
+	if err != nil {
+		return appErrorf(err, "No such user: %v", login)
+	}
+	if err := team.RemoveMember(member); err != nil {
+		return appErrorf(err, "Couldn't remove %v from team: %v", login, team.Name)
+	}
+	writeJSON(w, team)
+	return nil
+}
+
+// AddTeamSubs subscribes a team to a repo with the preferences in settings or the
+// default preferences, requires an owner
+func AddTeamSubs(w http.ResponseWriter, r *http.Request) *AppError {
+
+	ctx := appengine.NewContext(r)
+	user, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	repo := r.FormValue("repo")
+	if github.IsRepoPattern(repo) {
+		if _, err := github.ExpandRepos(ctx, repo); err != nil {
+			return appErrorf(err, "Couldn't subscribe to repos: %v", repo)
+		}
+	} else if err := github.UpdateRepo(ctx, repo); err != nil {
+		return appErrorf(err, "Couldn't subscribe to repo: %v", repo)
+	}
+	preferences := github.NewPreference()
+	if settings := r.FormValue("settings"); len(settings) != 0 {
+		if err := json.Unmarshal([]byte(settings), &preferences); err != nil {
+			return appErrorf(err, "Couldn't get settings for repo: %v", repo)
+		}
+	}
+	if err := team.Subscribe(user, repo, preferences); err != nil {
+		return appErrorf(err, "Couldn't subscribe team %v to repo: %v", team.Name, repo)
+	}
+	writeJSON(w, team.Subscriptions)
+	return nil
+}
+
+// UpdateTeamSub updates the preferences, filter and schedule of a team subscription, requires
+// an owner
+func UpdateTeamSub(w http.ResponseWriter, r *http.Request) *AppError {
+
+	_, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	repo := r.FormValue("repo")
+	subs, err := team.GetSubscriptions(repo)
+	if err != nil {
+		return appErrorf(err, "Couldn't update settings for repo: %v", repo)
+	}
+	sub := subs[0]
+	if settings := r.FormValue("settings"); len(settings) != 0 {
+		if err := json.Unmarshal([]byte(settings), &sub.EmailPreference); err != nil {
+			return appErrorf(err, "Couldn't get settings for repo: %v", repo)
+		}
+	}
+	if filter := r.FormValue("filter"); len(filter) != 0 {
+		sub.Filter = github.Filter{}
+		if err := json.Unmarshal([]byte(filter), &sub.Filter); err != nil {
+			return appErrorf(err, "Couldn't get filter for repo: %v", repo)
+		}
+	}
+	// An empty source resets the subscription to the default source
+	if source := r.FormValue("source"); len(r.Form["source"]) != 0 && github.ValidSource(source) {
+		sub.Source = source
+	}
+	if schedule := r.FormValue("schedule"); len(schedule) != 0 {
+		if _, err := github.ParseSchedule(schedule); err != nil {
+			return appErrorf(err, "Couldn't update schedule for repo: %v", repo)
+		}
+		sub.Schedule = schedule
+	}
+	if err := team.UpdateSubscription(repo, &sub); err != nil {
+		return appErrorf(err, "Couldn't update settings for repo: %v", repo)
+	}
+	writeJSON(w, sub)
+	return nil
+}
+
+// DelTeamSubs unsubscribes a team from a repo, requires an owner
+func DelTeamSubs(w http.ResponseWriter, r *http.Request) *AppError {
+
+	_, team, e := getOwnedTeam(w, r)
+	if e != nil {
+		return e
+	}
+	repo := r.FormValue("repo")
+	if err := team.Unsubscribe(repo); err != nil {
+		writeJSON(w, status{err, "Could not unsubscribe repo", 500})
+		return appErrorf(err, "Couldn't unsubscribe team %v from repo: %v", team.Name, repo)
+	}
+	writeJSON(w, status{nil, "ok", 200})
+	return nil
+}
+
+// getTeam returns the authenticated user and the team in the team form value, which the
+// user must be a member of
+func getTeam(w http.ResponseWriter, r *http.Request) (github.User, github.Team, *AppError) {
+	user, err := getAuthenticatedUser(w, r)
+	if err != nil {
+		return user, github.Team{}, appErrorf(err, "No such user: %v", user.Login)
+	}
+	id, err := strconv.ParseUint(r.FormValue("team"), 10, 64)
+	if err != nil {
+		return user, github.Team{}, appErrorf(err, "Invalid team: %v", r.FormValue("team"))
+	}
+	team, err := github.FindTeam(uint(id))
+	if err != nil {
+		return user, github.Team{}, appErrorf(err, "No such team: %v", id)
+	}
+	if !team.IsMember(user) {
+		// Teams of other users are reported as missing
+		return user, github.Team{}, &AppError{
+			Error:   fmt.Errorf("%v is not a member of team %v", user.Login, id),
+			Message: fmt.Sprintf("No such team: %v", id),
+			Code:    http.StatusNotFound,
+		}
+	}
+	return user, team, nil
+}
+
+// getOwnedTeam is like getTeam for a user that must be an owner of the team
+func getOwnedTeam(w http.ResponseWriter, r *http.Request) (github.User, github.Team, *AppError) {
+	user, team, e := getTeam(w, r)
+	if e != nil {
+		return user, team, e
+	}
+	if !team.IsOwner(user) {
+		return user, team, &AppError{
+			Error:   fmt.Errorf("%v is not an owner", user.Login),
+			Message: fmt.Sprintf("Couldn't change team: %v", team.Name),
+			Code:    http.StatusForbidden,
+		}
+	}
+	return user, team, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+)
+
+// unsubscribePage asks to confirm an unsubscribe or leave team link, or reports that it
+// was used
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Unsubscribe</title></head>
+<body>
+{{ if .Done }}
+{{ if .Team }}
+<p>You have left the team {{ .Team }}.</p>
+{{ else }}
+<p>You have been unsubscribed from {{ if .Repo }}{{ .Repo }}{{ else }}all repos{{ end }}.</p>
+{{ end }}
+{{ else }}
+<form method="POST">
+{{ if .Team }}
+<p>Leave the team {{ .Team }} and stop its emails?</p>
+{{ else }}
+<p>Stop emails about {{ if .Repo }}{{ .Repo }}{{ else }}all of your repos{{ end }}?</p>
+{{ end }}
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">Unsubscribe</button>
+</form>
+{{ end }}
+<p><a href="/">github-issue-tracker</a></p>
+</body>
+</html>
+`))
+
+// Unsubscribe unsubscribes the user of the token form value from its repo, or from all
+// repos if it has none, without logging in. Tokens are signed with the secret in the
+// UNSUBSCRIBE_SECRET environment variable. GET requests show a page that unsubscribes with
+// a POST request, so that links opened by mail scanners don't unsubscribe, and POST
+// requests unsubscribe, such as the RFC 8058 one-click requests of mail clients. Tokens
+// of team digests remove the user from the team instead.
+func Unsubscribe(w http.ResponseWriter, r *http.Request) *AppError {
+
+	token := r.FormValue("token")
+	secret := os.Getenv("UNSUBSCRIBE_SECRET")
+	if userID, teamID, err := github.ParseLeaveTeamToken(secret, token); err == nil {
+		return leaveTeam(w, r, userID, teamID, token)
+	}
+	userID, repo, err := github.ParseUnsubscribeToken(secret, token)
+	if err != nil {
+		return &AppError{
+			Error:   err,
+			Message: "Invalid unsubscribe link",
+			Code:    http.StatusForbidden,
+		}
+	}
+	page := unsubscribeData{Repo: repo, Token: token, Done: r.Method == "POST"}
+	if page.Done {
+		user := github.User{ID: userID}
+		if len(repo) == 0 {
+			err = user.UnsubscribeAll()
+		} else {
+			err = user.Unsubscribe(repo)
+		}
+		if err != nil {
+			return appErrorf(err, "Couldn't unsubscribe user %v from: %v", userID, repo)
+		}
+	}
+	return showUnsubscribePage(w, page)
+}
+
+// unsubscribeData is shown by unsubscribePage
+type unsubscribeData struct {
+	Repo  string
+	Team  string
+	Token string
+	Done  bool
+}
+
+// leaveTeam removes the user with userID from the team with teamID for the POST requests
+// of the token of a leave team link. The last owner of a team can't leave it.
+func leaveTeam(w http.ResponseWriter, r *http.Request, userID uint64, teamID uint,
+	token string) *AppError {
+
+	team, err := github.FindTeam(teamID)
+	if err != nil {
+		return appErrorf(err, "Couldn't find team %v", teamID)
+	}
+	page := unsubscribeData{Team: team.Name, Token: token, Done: r.Method == "POST"}
+	if page.Done {
+		user := github.User{ID: userID}
+		for _, m := range team.Members {
+			if m.UserID == userID {
+				user = m.User
+			}
+		}
+		if team.LastOwner(user) {
+			// Mail clients retry one-click unsubscribes that fail with a server error
+			return &AppError{
+				Error: fmt.Errorf("%v is the last owner of team %v", userID, team.ID),
+				Message: "You are the only owner of the team " + team.Name + ", delete the " +
+					"team or make another member an owner before leaving it",
+				Code: http.StatusConflict,
+			}
+		}
+		if err := team.RemoveMember(user); err != nil {
+			return appErrorf(err, "Couldn't remove user %v from team: %v", userID, team.Name)
+		}
+	}
+	return showUnsubscribePage(w, page)
+}
+
+// showUnsubscribePage writes the unsubscribePage of page
+func showUnsubscribePage(w http.ResponseWriter, page unsubscribeData) *AppError {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(w, page); err != nil {
+		return appErrorf(err, "Couldn't show unsubscribe page")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+)
+
+// maxWebhookSize is the largest webhook payload that is read, GitHub caps payloads at 25MB
+const maxWebhookSize = 25 << 20
+
+// GitHubWebhook stores the GitHub activity sent by webhooks that are signed with the
+// secret in the GITHUB_WEBHOOK_SECRET environment variable
+func GitHubWebhook(w http.ResponseWriter, r *http.Request) *AppError {
+
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if len(secret) == 0 {
+		return appErrorf(fmt.Errorf("GITHUB_WEBHOOK_SECRET not set"), "Webhooks are not configured")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		return appErrorf(err, "Couldn't read webhook")
+	}
+	if !github.VerifyWebhook(secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		return &AppError{
+			Error:   fmt.Errorf("invalid signature"),
+			Message: "Invalid webhook signature",
+			Code:    http.StatusUnauthorized,
+		}
+	}
+	event := r.Header.Get("X-GitHub-Event")
+	stored, err := github.SaveWebhook(event, body)
+	if err != nil {
+		return appErrorf(err, "Couldn't save %s webhook", event)
+	}
+	if !stored {
+		// Acknowledge events such as ping that aren't stored
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
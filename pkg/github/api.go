@@ -16,10 +16,13 @@ package github
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"google.golang.org/appengine/log"
 
@@ -29,23 +32,135 @@ import (
 
 const endpoint = "https://api.github.com/"
 
+// maxPages is the number of pages that APIPages follows for a request
+const maxPages = 10
+
+// ErrRateLimited is returned when the GitHub API rate limit for the credentials is reached
+var ErrRateLimited = fmt.Errorf("GitHub API rate limit reached, try again later")
+
 type clientSecrets struct {
 	ClientID     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
 }
 
-// API makes an authenticated request to the GitHub API using Oauth2 Client ID & Secret
+// API makes an authenticated request to the GitHub API with the token in the GITHUB_TOKEN
+// environment variable, such as a personal access token or the token of a GitHub App
+// installation, which can read the private repos that it has access to. Without a token
+// the request uses the Oauth2 Client ID & Secret of the app, which only read public repos.
 func API(ctx context.Context, path string, params ...string) (*http.Response, error) {
 
-	credentials := parseCredentials(ctx)
-	webClient := urlfetch.Client(ctx)
+	credentials := "?"
+	if len(os.Getenv("GITHUB_TOKEN")) == 0 {
+		credentials = parseCredentials(ctx)
+	}
 	additional := ""
 	for _, s := range params {
 		additional = additional + "&" + s
 	}
 	url := endpoint + path + credentials + additional
 	log.Debugf(ctx, "Github API Fetch: %s", endpoint+path+"?"+additional)
-	return webClient.Get(url)
+	return apiGet(ctx, url)
+}
+
+// apiGet requests url with the token in GITHUB_TOKEN, if it is set
+func apiGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); len(token) != 0 {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	return urlfetch.Client(ctx).Do(req)
+}
+
+// APIPages makes an authenticated request to the GitHub API like API and follows the
+// pagination of the response with the Link header. visit is called with the body of
+// each page and stops the pagination by returning false. After maxPages pages the
+// pagination stops with a warning that the results were cut off.
+func APIPages(ctx context.Context, path string, visit func(body []byte) (bool, error),
+	params ...string) error {
+
+	resp, err := API(ctx, path, params...)
+	for page := 1; ; page++ {
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			if rateLimited(resp) {
+				return ErrRateLimited
+			}
+			return fmt.Errorf("API Error: %s", resp.Status)
+		}
+		resBody, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return readErr
+		}
+		if more, visitErr := visit(resBody); visitErr != nil || !more {
+			return visitErr
+		}
+		next := nextPage(resp.Header.Get("Link"))
+		if len(next) == 0 {
+			return nil
+		}
+		if page == maxPages {
+			log.Warningf(ctx, "Github API Fetch: stopped after %d pages of %s, later results "+
+				"are left out", page, path)
+			return nil
+		}
+		// the next page keeps the query of the first request, including credentials
+		resp, err = apiGet(ctx, next)
+	}
+}
+
+// RateRemaining returns the number of GitHub API requests left for the credentials until
+// the rate limit resets. Requests to rate_limit don't count against the limit.
+func RateRemaining(ctx context.Context) (int, error) {
+	resp, err := API(ctx, "rate_limit")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("API Error: %s", resp.Status)
+	}
+	var limits struct {
+		Resources struct {
+			Core struct {
+				Remaining int `json:"remaining"`
+			} `json:"core"`
+		} `json:"resources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&limits); err != nil {
+		return 0, err
+	}
+	return limits.Resources.Core.Remaining, nil
+}
+
+// rateLimited reports whether resp was refused because the rate limit was reached
+func rateLimited(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// nextPage returns the url for rel="next" in a Link header, or an empty string if
+// there is no next page
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		fields := strings.Split(part, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		url := strings.TrimSpace(fields[0])
+		for _, param := range fields[1:] {
+			if strings.TrimSpace(param) == `rel="next"` &&
+				strings.HasPrefix(url, "<") && strings.HasSuffix(url, ">") {
+				return url[1 : len(url)-1]
+			}
+		}
+	}
+	return ""
 }
 
 // parseCredentials parses the json with github api credentials and returns
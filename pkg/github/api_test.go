@@ -50,3 +50,36 @@ func TestAPI(t *testing.T) {
 		t.Errorf("Rate limit exceeded, Remaining: %v", resp.Header)
 	}
 }
+
+var nextPageTests = []struct {
+	testcase string
+	link     string
+	want     string
+}{
+	{
+		"Empty Link header",
+		"",
+		"",
+	},
+	{
+		"Next and last pages",
+		`<https://api.github.com/repositories/1/issues/events?page=2>; rel="next", ` +
+			`<https://api.github.com/repositories/1/issues/events?page=5>; rel="last"`,
+		"https://api.github.com/repositories/1/issues/events?page=2",
+	},
+	{
+		"Last page",
+		`<https://api.github.com/repositories/1/issues/events?page=1>; rel="first", ` +
+			`<https://api.github.com/repositories/1/issues/events?page=4>; rel="prev"`,
+		"",
+	},
+}
+
+// TestNextPage tests parsing the next page from Link headers
+func TestNextPage(t *testing.T) {
+	for _, test := range nextPageTests {
+		if got := nextPage(test.link); got != test.want {
+			t.Errorf("%s: nextPage() got %q, want %q", test.testcase, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,783 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine/log"
+)
+
+// APISource is an EventSource that lists issue events and comments of each repo with
+// the GitHub API. Unlike githubarchive it has no delay and covers private repos that
+// the API credentials can access.
+type APISource struct{}
+
+// apiUser is a user in GitHub API responses
+type apiUser struct {
+	Login string `json:"login"`
+}
+
+// apiIssue is an issue in GitHub API responses
+type apiIssue struct {
+	ID            int64     `json:"id"`
+	Number        int       `json:"number"`
+	Title         string    `json:"title"`
+	User          apiUser   `json:"user"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	RepositoryURL string    `json:"repository_url"`
+	HTMLURL       string    `json:"html_url"`
+	PullRequest   *struct{} `json:"pull_request"` // set when the issue is a pull request
+	State         string    `json:"state"`
+	Body          string    `json:"body"`
+	Labels        []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Assignees []apiUser `json:"assignees"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+}
+
+// apiIssueEvent is an event from the repos/:repo/issues/events endpoint
+type apiIssueEvent struct {
+	Event             string    `json:"event"`
+	Actor             apiUser   `json:"actor"`
+	RequestedReviewer *apiUser  `json:"requested_reviewer"` // set for "review_requested"
+	CreatedAt         time.Time `json:"created_at"`
+	Issue             apiIssue  `json:"issue"`
+}
+
+// apiComment is a comment on an issue, or a review comment on a pull request when
+// PullRequestURL is set
+type apiComment struct {
+	ID             int64     `json:"id"`
+	Body           string    `json:"body"`
+	User           apiUser   `json:"user"`
+	CreatedAt      time.Time `json:"created_at"`
+	HTMLURL        string    `json:"html_url"`
+	PullRequestURL string    `json:"pull_request_url"`
+}
+
+// apiPullRequest is a pull request in GitHub API responses
+type apiPullRequest struct {
+	ID        int64      `json:"id"`
+	Number    int        `json:"number"`
+	Title     string     `json:"title"`
+	User      apiUser    `json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ClosedAt  *time.Time `json:"closed_at"`
+	MergedAt  *time.Time `json:"merged_at"`
+	MergedBy  *apiUser   `json:"merged_by"` // not set when listing pull requests
+	HTMLURL   string     `json:"html_url"`
+	Base      struct {
+		Repo struct {
+			URL string `json:"url"`
+		} `json:"repo"`
+	} `json:"base"`
+}
+
+// apiEvent is an event from the repos/:repo/events endpoint, which lists events from
+// the last 90 days
+type apiEvent struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiRelease is a release in GitHub API responses
+type apiRelease struct {
+	ID          int64     `json:"id"`
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Author      apiUser   `json:"author"`
+	PublishedAt time.Time `json:"published_at"`
+	HTMLURL     string    `json:"html_url"`
+}
+
+// apiRepo is a repository in GitHub API responses
+type apiRepo struct {
+	ID        int64     `json:"id"`
+	FullName  string    `json:"full_name"`
+	Owner     apiUser   `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	HTMLURL   string    `json:"html_url"`
+	URL       string    `json:"url"`
+}
+
+// apiReview is a review of a pull request in GitHub API responses
+type apiReview struct {
+	ID          int64     `json:"id"`
+	Body        string    `json:"body"`
+	User        apiUser   `json:"user"`
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	HTMLURL     string    `json:"html_url"`
+}
+
+// Issues lists issues opened within w, or issue events of the given action within w
+func (APISource) Issues(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	issues := []Issue{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		var err error
+		if action == "opened" {
+			issues, err = openedIssues(ctx, repo, w, limit, issues)
+		} else {
+			issues, err = issueEvents(ctx, repo, action, w, limit, issues)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(issues)) >= limit {
+			break
+		}
+	}
+	return issues, nil
+}
+
+// openedIssues appends issues of repo created within w to issues, newest first
+func openedIssues(ctx context.Context,
+	repo string, w Window, limit uint64, issues []Issue) ([]Issue, error) {
+
+	visit := func(body []byte) (bool, error) {
+		var page []apiIssue
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, i := range page {
+			if i.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if i.PullRequest != nil || !i.CreatedAt.Before(w.End) {
+				continue
+			}
+			issues = append(issues, i.toIssue(i.CreatedAt))
+			if uint64(len(issues)) >= limit {
+				return false, nil
+			}
+		}
+		return len(page) != 0, nil
+	}
+	err := APIPages(ctx, repoAPI+repo+"/issues", visit, "state=all", "sort=created",
+		"direction=desc", "per_page=100", "since="+w.Start.UTC().Format(time.RFC3339))
+	return issues, err
+}
+
+// issueEvents appends issues of repo with an event of action within w to issues, the
+// issue is created at the time of the event
+func issueEvents(ctx context.Context,
+	repo string, action string, w Window, limit uint64, issues []Issue) ([]Issue, error) {
+
+	visit := func(body []byte) (bool, error) {
+		var page []apiIssueEvent
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, e := range page {
+			// events are listed newest first
+			if e.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if e.Event != action || e.Issue.PullRequest != nil || !e.CreatedAt.Before(w.End) {
+				continue
+			}
+			issues = append(issues, e.Issue.toIssue(e.CreatedAt))
+			if uint64(len(issues)) >= limit {
+				return false, nil
+			}
+		}
+		return len(page) != 0, nil
+	}
+	err := APIPages(ctx, repoAPI+repo+"/issues/events", visit, "per_page=100")
+	return issues, err
+}
+
+// Comments lists comments on issues of repos that were created within w, the API
+// doesn't give the state of the issue so comments on closed issues are included
+func (APISource) Comments(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	comments := []Comment{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		repoURL := endpoint + repoAPI + repo
+		visit := func(body []byte) (bool, error) {
+			var page []apiComment
+			if err := json.Unmarshal(body, &page); err != nil {
+				return false, err
+			}
+			for _, c := range page {
+				if c.CreatedAt.Before(w.Start) {
+					return false, nil
+				}
+				if !c.CreatedAt.Before(w.End) {
+					continue
+				}
+				comments = append(comments, c.toComment(repoURL))
+				if uint64(len(comments)) >= limit {
+					return false, nil
+				}
+			}
+			return len(page) != 0, nil
+		}
+		err := APIPages(ctx, repoAPI+repo+"/issues/comments", visit, "sort=created",
+			"direction=desc", "per_page=100", "since="+w.Start.UTC().Format(time.RFC3339))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(comments)) >= limit {
+			break
+		}
+	}
+	return comments, nil
+}
+
+// toIssue converts an issue from the GitHub API to an Issue created at the given time
+func (i apiIssue) toIssue(created time.Time) Issue {
+	return Issue{
+		ID:        i.ID,
+		Number:    i.Number,
+		Title:     i.Title,
+		Author:    i.User.Login,
+		Created:   created,
+		UpdatedAt: i.UpdatedAt,
+		Repo:      i.RepositoryURL,
+		URL:       i.HTMLURL,
+		State:     i.State,
+		Body:      trimBody(i.Body),
+		Milestone: i.milestone(),
+		Labels:    i.labels(),
+		Assignees: i.assignees(),
+	}
+}
+
+// milestone returns the title of the issue's milestone, or an empty string if there's none
+func (i apiIssue) milestone() string {
+	if i.Milestone == nil {
+		return ""
+	}
+	return i.Milestone.Title
+}
+
+// labels returns the names of the labels on the issue
+func (i apiIssue) labels() Names {
+	var names Names
+	for _, l := range i.Labels {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// assignees returns the login names of the users assigned to the issue
+func (i apiIssue) assignees() Names {
+	var names Names
+	for _, u := range i.Assignees {
+		names = append(names, u.Login)
+	}
+	return names
+}
+
+// toComment converts a comment from the GitHub API to a Comment on an issue of repoURL
+func (c apiComment) toComment(repoURL string) Comment {
+	return Comment{
+		ID:      c.ID,
+		IssueID: issueIDFromURL(c.HTMLURL),
+		Repo:    repoURL,
+		Body:    trimBody(c.Body),
+		Author:  c.User.Login,
+		Created: c.CreatedAt,
+		URL:     c.HTMLURL,
+	}
+}
+
+// PullRequests lists pull requests opened within w, or issue events of pull requests for
+// the given action within w. The merged and closed issue events are both sent when a pull
+// request is merged, so closed pull requests leave out the ones that were merged.
+func (APISource) PullRequests(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	pulls := []PullRequest{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		var err error
+		if action == "opened" {
+			pulls, err = openedPullRequests(ctx, repo, w, limit, pulls)
+		} else {
+			pulls, err = pullRequestEvents(ctx, repo, action, w, limit, pulls)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(pulls)) >= limit {
+			break
+		}
+	}
+	return pulls, nil
+}
+
+// openedPullRequests appends pull requests of repo created within w to pulls, newest first
+func openedPullRequests(ctx context.Context,
+	repo string, w Window, limit uint64, pulls []PullRequest) ([]PullRequest, error) {
+
+	visit := func(body []byte) (bool, error) {
+		var page []apiPullRequest
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, p := range page {
+			if p.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if !p.CreatedAt.Before(w.End) {
+				continue
+			}
+			pulls = append(pulls, p.toPullRequest("opened", p.User.Login, p.CreatedAt))
+			if uint64(len(pulls)) >= limit {
+				return false, nil
+			}
+		}
+		return len(page) != 0, nil
+	}
+	err := APIPages(ctx, repoAPI+repo+"/pulls", visit, "state=all", "sort=created",
+		"direction=desc", "per_page=100")
+	return pulls, err
+}
+
+// pullRequestEvents appends pull requests of repo with an issue event of action within w
+// to pulls, the pull request is created at the time of the event. Issue events name the
+// issue of the pull request, so the pull request is found in the ones updated within w to
+// give it the same ID as other sources.
+func pullRequestEvents(ctx context.Context,
+	repo string, action string, w Window, limit uint64, pulls []PullRequest) ([]PullRequest, error) {
+
+	merged := map[int]bool{}
+	found := []apiIssueEvent{}
+	visit := func(body []byte) (bool, error) {
+		var page []apiIssueEvent
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, e := range page {
+			// events are listed newest first
+			if e.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if e.Issue.PullRequest == nil || !e.CreatedAt.Before(w.End) {
+				continue
+			}
+			if e.Event == "merged" {
+				merged[e.Issue.Number] = true
+			}
+			if e.Event == action {
+				found = append(found, e)
+			}
+		}
+		return len(page) != 0, nil
+	}
+	if err := APIPages(ctx, repoAPI+repo+"/issues/events", visit, "per_page=100"); err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return pulls, nil
+	}
+	updated, err := updatedPullRequests(ctx, repo, w)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := map[int]apiPullRequest{}
+	for _, p := range updated {
+		byNumber[p.Number] = p
+	}
+	for _, e := range found {
+		if action == "closed" && merged[e.Issue.Number] {
+			continue
+		}
+		if uint64(len(pulls)) >= limit {
+			break
+		}
+		p, ok := byNumber[e.Issue.Number]
+		if !ok {
+			// updated after the pull requests were listed
+			continue
+		}
+		pull := p.toPullRequest(action, e.Actor.Login, e.CreatedAt)
+		if e.RequestedReviewer != nil {
+			pull.Reviewer = e.RequestedReviewer.Login
+		}
+		pulls = append(pulls, pull)
+	}
+	return pulls, nil
+}
+
+// updatedPullRequests lists the pull requests of repo updated since the start of w,
+// most recently updated first
+func updatedPullRequests(ctx context.Context, repo string, w Window) ([]apiPullRequest, error) {
+	updated := []apiPullRequest{}
+	visit := func(body []byte) (bool, error) {
+		var page []apiPullRequest
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, p := range page {
+			if p.UpdatedAt.Before(w.Start) {
+				return false, nil
+			}
+			updated = append(updated, p)
+		}
+		return len(page) != 0, nil
+	}
+	err := APIPages(ctx, repoAPI+repo+"/pulls", visit, "state=all", "sort=updated",
+		"direction=desc", "per_page=100")
+	return updated, err
+}
+
+// Reviews lists review comments created within w, or reviews submitted within w on pull
+// requests that were updated within w
+func (APISource) Reviews(ctx context.Context,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	reviews := []Review{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		var err error
+		if kind == "review_comment" {
+			reviews, err = reviewComments(ctx, repo, w, limit, reviews)
+		} else {
+			reviews, err = pullRequestReviews(ctx, repo, w, limit, reviews)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(reviews)) >= limit {
+			break
+		}
+	}
+	return reviews, nil
+}
+
+// reviewComments appends review comments on pull requests of repo created within w
+// to reviews
+func reviewComments(ctx context.Context,
+	repo string, w Window, limit uint64, reviews []Review) ([]Review, error) {
+
+	repoURL := endpoint + repoAPI + repo
+	visit := func(body []byte) (bool, error) {
+		var page []apiComment
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, c := range page {
+			if c.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if !c.CreatedAt.Before(w.End) {
+				continue
+			}
+			reviews = append(reviews, c.toReview(repoURL, 0, ""))
+			if uint64(len(reviews)) >= limit {
+				return false, nil
+			}
+		}
+		return len(page) != 0, nil
+	}
+	err := APIPages(ctx, repoAPI+repo+"/pulls/comments", visit, "sort=created",
+		"direction=desc", "per_page=100", "since="+w.Start.UTC().Format(time.RFC3339))
+	return reviews, err
+}
+
+// maxReviewedPulls is the number of pull requests of a repo whose reviews are listed
+const maxReviewedPulls = 30
+
+// pullRequestReviews appends reviews submitted within w on pull requests of repo to
+// reviews. The API has no list of reviews for a repo, so the reviews of each pull
+// request updated within w are listed, for up to maxReviewedPulls of the most recently
+// updated ones.
+func pullRequestReviews(ctx context.Context,
+	repo string, w Window, limit uint64, reviews []Review) ([]Review, error) {
+
+	updated, err := updatedPullRequests(ctx, repo, w)
+	if err != nil {
+		return nil, err
+	}
+	listed := 0
+	for _, p := range updated {
+		if !p.CreatedAt.Before(w.End) {
+			// reviewed after w
+			continue
+		}
+		if listed++; listed > maxReviewedPulls {
+			log.Warningf(ctx, "Reviews of %s listed for %d pull requests only", repo,
+				maxReviewedPulls)
+			break
+		}
+		visit := func(body []byte) (bool, error) {
+			var page []apiReview
+			if err := json.Unmarshal(body, &page); err != nil {
+				return false, err
+			}
+			for _, r := range page {
+				if r.SubmittedAt.Before(w.Start) || !r.SubmittedAt.Before(w.End) {
+					continue
+				}
+				reviews = append(reviews, r.toReview(p))
+				if uint64(len(reviews)) >= limit {
+					return false, nil
+				}
+			}
+			return true, nil
+		}
+		path := repoAPI + repo + "/pulls/" + strconv.Itoa(p.Number) + "/reviews"
+		if err := APIPages(ctx, path, visit, "per_page=100"); err != nil {
+			return nil, err
+		}
+		if uint64(len(reviews)) >= limit {
+			break
+		}
+	}
+	return reviews, nil
+}
+
+// toPullRequest converts a pull request from the GitHub API to a PullRequest with an event
+// of action by actor at the given time
+func (p apiPullRequest) toPullRequest(action string, actor string, created time.Time) PullRequest {
+	return PullRequest{
+		ID:        p.ID,
+		Number:    p.Number,
+		Title:     p.Title,
+		Author:    p.User.Login,
+		Actor:     actor,
+		Action:    action,
+		Created:   created,
+		UpdatedAt: p.UpdatedAt,
+		Repo:      p.Base.Repo.URL,
+		URL:       p.HTMLURL,
+	}
+}
+
+// toReview converts a review from the GitHub API to a Review of the pull request p
+func (r apiReview) toReview(p apiPullRequest) Review {
+	return Review{
+		ID:         r.ID,
+		PullNumber: p.Number,
+		PullTitle:  p.Title,
+		Author:     r.User.Login,
+		State:      reviewState(r.State),
+		Body:       trimBody(r.Body),
+		Created:    r.SubmittedAt,
+		Repo:       p.Base.Repo.URL,
+		URL:        r.HTMLURL,
+	}
+}
+
+// toReview converts a review comment from the GitHub API to a Review on a pull request of
+// repoURL, the number and title of the pull request are set if known
+func (c apiComment) toReview(repoURL string, number int, title string) Review {
+	if number == 0 {
+		// pull_request_url ends with the number of the pull request
+		path := strings.Split(c.PullRequestURL, "/")
+		number, _ = strconv.Atoi(path[len(path)-1])
+	}
+	return Review{
+		ID:         c.ID,
+		Comment:    true,
+		PullNumber: number,
+		PullTitle:  title,
+		Author:     c.User.Login,
+		Body:       trimBody(c.Body),
+		Created:    c.CreatedAt,
+		Repo:       repoURL,
+		URL:        c.HTMLURL,
+	}
+}
+
+// repoEvents calls visit for the events of repo created within w, newest first
+func repoEvents(ctx context.Context, repo string, w Window, visit func(e apiEvent) error) error {
+	return APIPages(ctx, repoAPI+repo+"/events", func(body []byte) (bool, error) {
+		var page []apiEvent
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, e := range page {
+			if e.CreatedAt.Before(w.Start) {
+				return false, nil
+			}
+			if !e.CreatedAt.Before(w.End) {
+				continue
+			}
+			if err := visit(e); err != nil {
+				return false, err
+			}
+		}
+		return len(page) != 0, nil
+	}, "per_page=100")
+}
+
+// Releases lists releases of repos published within w
+func (APISource) Releases(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Release, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	releases := []Release{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		repoURL := endpoint + repoAPI + repo
+		visit := func(body []byte) (bool, error) {
+			var page []apiRelease
+			if err := json.Unmarshal(body, &page); err != nil {
+				return false, err
+			}
+			for _, r := range page {
+				// drafts aren't published and are listed first
+				if r.PublishedAt.IsZero() || !r.PublishedAt.Before(w.End) {
+					continue
+				}
+				if r.PublishedAt.Before(w.Start) {
+					return false, nil
+				}
+				releases = append(releases, r.toRelease(repoURL))
+				if uint64(len(releases)) >= limit {
+					return false, nil
+				}
+			}
+			return len(page) != 0, nil
+		}
+		if err := APIPages(ctx, repoAPI+repo+"/releases", visit, "per_page=100"); err != nil {
+			return nil, err
+		}
+		if uint64(len(releases)) >= limit {
+			break
+		}
+	}
+	return releases, nil
+}
+
+// Forks lists forks of repos created within w
+func (APISource) Forks(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+
+	limit = (&Options{Limit: limit}).getLimits()
+	forks := []Fork{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		repoURL := endpoint + repoAPI + repo
+		visit := func(body []byte) (bool, error) {
+			var page []apiRepo
+			if err := json.Unmarshal(body, &page); err != nil {
+				return false, err
+			}
+			for _, r := range page {
+				if r.CreatedAt.Before(w.Start) {
+					return false, nil
+				}
+				if !r.CreatedAt.Before(w.End) {
+					continue
+				}
+				forks = append(forks, r.toFork(repoURL))
+				if uint64(len(forks)) >= limit {
+					return false, nil
+				}
+			}
+			return len(page) != 0, nil
+		}
+		err := APIPages(ctx, repoAPI+repo+"/forks", visit, "sort=newest", "per_page=100")
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(forks)) >= limit {
+			break
+		}
+	}
+	return forks, nil
+}
+
+// Stars counts the WatchEvents of repos within w, the GitHub API only lists the events
+// of the last 90 days
+func (APISource) Stars(ctx context.Context,
+	repos []string, w Window) (map[string]int, error) {
+
+	stars := map[string]int{}
+	repos, err := ExpandRepos(ctx, repos...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		err := repoEvents(ctx, repo, w, func(e apiEvent) error {
+			if e.Type == "WatchEvent" {
+				stars[repo]++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stars, nil
+}
+
+// toRelease converts a release from the GitHub API to a Release of repoURL
+func (r apiRelease) toRelease(repoURL string) Release {
+	return Release{
+		ID:      r.ID,
+		TagName: r.TagName,
+		Name:    r.Name,
+		Author:  r.Author.Login,
+		Created: r.PublishedAt,
+		Repo:    repoURL,
+		URL:     r.HTMLURL,
+	}
+}
+
+// toFork converts a forked repo from the GitHub API to a Fork of repoURL
+func (r apiRepo) toFork(repoURL string) Fork {
+	return Fork{
+		ID:       r.ID,
+		FullName: r.FullName,
+		Owner:    r.Owner.Login,
+		Created:  r.CreatedAt,
+		Repo:     repoURL,
+		URL:      r.HTMLURL,
+	}
+}
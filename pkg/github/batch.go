@@ -0,0 +1,278 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"google.golang.org/appengine/log"
+
+	"golang.org/x/net/context"
+)
+
+// batchLimit is the number of results for each query of a batch, which is shared by all users
+const batchLimit = 10000
+
+// batchRetention is the number of days that batches are kept for
+const batchRetention = 7
+
+// batchRowEvents is the largest number of events in a BatchEvents row
+const batchRowEvents = 500
+
+// EventBatch stages GitHub activity that is fetched once for the subscriptions of all users
+// in a cron run, so that every user's digest can be composed without querying BigQuery again.
+// The lists of events are staged in BatchEvents rows, so that the size of a batch isn't
+// limited by the size of a row.
+type EventBatch struct {
+	ID        uint      `gorm:"primary_key;AUTO_INCREMENT"`
+	Name      string    `gorm:"unique_index;not null;"` // BatchName of the email type and window
+	Type      Frequency `gorm:"not null;"`
+	Data      string    `gorm:"not null;type:MEDIUMTEXT;"` // JSON events not in BatchEvents
+	CreatedAt time.Time
+}
+
+// BatchEvents holds up to batchRowEvents JSON encoded events of one kind of an EventBatch.
+// The rows of a kind hold its events in the order of the source when read by ID.
+type BatchEvents struct {
+	ID      uint   `gorm:"primary_key;AUTO_INCREMENT"`
+	BatchID uint   `gorm:"index;not null;"`
+	Kind    string `gorm:"size:32;not null;"` // name of the list of events, such as "opened"
+	Data    string `gorm:"not null;type:MEDIUMTEXT;"`
+}
+
+// FetchBatch fetches activity for all subscriptions from source with a single set of queries
+// and stores it as the batch for emailType. It returns the batch name to use with FetchBatchData.
+func FetchBatch(c context.Context, source EventSource,
+	subscriptions []Subscription, emailType Frequency) (string, error) {
+
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	now := time.Now().In(usLoc)
+	window := DigestWindow(source, subscriptions, emailType, now)
+	return fetchBatch(c, source, subscriptions, emailType, window, BatchName(emailType, window))
+}
+
+// FetchWindowBatch is like FetchBatch for the activity within window, such as the window of
+// a scheduled digest returned by DueDigests, up to the Horizon of source at its end. The
+// batch is named by the BatchName of window.
+func FetchWindowBatch(c context.Context, source EventSource,
+	subscriptions []Subscription, emailType Frequency, window Window) (string, error) {
+
+	name := BatchName(emailType, window)
+	return fetchBatch(c, source, subscriptions, emailType, window.Loaded(source, subscriptions), name)
+}
+
+// BatchName returns the name of the batch stored by FetchBatch or FetchWindowBatch for
+// emailType and window, which is the same for windows in different time zones
+func BatchName(emailType Frequency, window Window) string {
+	return strconv.Itoa(int(emailType)) + "-" + window.Start.UTC().Format("200601021504") + "-" +
+		window.End.UTC().Format("200601021504")
+}
+
+// fetchBatch fetches activity for all subscriptions within window and stores it as the
+// batch with the given name. Batches are named by their window, so a stored batch with the
+// name is kept for tasks that may be reading it, such as when the cron job runs again.
+func fetchBatch(c context.Context, source EventSource, subscriptions []Subscription,
+	emailType Frequency, window Window, name string) (string, error) {
+
+	if DB == nil {
+		return "", fmt.Errorf("Failed to fetch batch, invalid DB Connection")
+	}
+	//setup global context to use for logging
+	ctx = c
+	stored := 0
+	if err := DB.Model(&EventBatch{}).Where("name = ?", name).Count(&stored).Error; err != nil {
+		return "", err
+	}
+	if stored != 0 {
+		log.Infof(ctx, "Batch %s is already stored", name)
+		return name, nil
+	}
+	data, err := fetchEvents(ctx, source, subscriptions, emailType, window, batchLimit)
+	if err != nil {
+		return "", err
+	}
+	for kind, list := range batchKinds(&data) {
+		if n := reflect.ValueOf(list).Elem().Len(); n >= batchLimit {
+			log.Warningf(ctx, "Batch %s has %d %s events, the limit of a batch query, later "+
+				"events are missing", name, n, kind)
+		}
+	}
+	rows, err := splitEvents(&data)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch batch, error converting to JSON: %v", err)
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch batch, error converting to JSON: %v", err)
+	}
+	now := time.Now()
+	batch := EventBatch{
+		Name: name,
+		Type: emailType,
+		Data: string(encoded),
+	}
+	tx := DB.Begin()
+	if err := tx.Create(&batch).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	for i := range rows {
+		rows[i].BatchID = batch.ID
+		if err := tx.Create(&rows[i]).Error; err != nil {
+			tx.Rollback()
+			return "", fmt.Errorf("Failed to store batch %s: %v", batch.Name, err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return "", err
+	}
+	if err := removeBatches(now.AddDate(0, 0, -batchRetention)); err != nil {
+		log.Errorf(ctx, "Failed to remove old batches: %v", err)
+	}
+	log.Infof(ctx, "Stored batch %s for %d subscriptions in %d rows", batch.Name,
+		len(subscriptions), len(rows))
+	return batch.Name, nil
+}
+
+// removeBatches removes the batches created before t with their events, in one transaction
+func removeBatches(t time.Time) error {
+	ids := []uint{}
+	if err := DB.Model(&EventBatch{}).Where("created_at < ?", t).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	tx := DB.Begin()
+	if err := tx.Where("batch_id IN (?)", ids).Delete(BatchEvents{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id IN (?)", ids).Delete(EventBatch{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// FetchBatchData composes email payloads for subscriptions from the batch stored by
+// FetchBatch with the given name
+func FetchBatchData(c context.Context,
+	subscriptions []Subscription, emailType Frequency, name string) ([]EmailPayload, error) {
+
+	//setup global context to use for logging
+	ctx = c
+	data, err := readBatch(name)
+	if err != nil {
+		return nil, err
+	}
+	return makePayloads(subscriptions, emailType, data), nil
+}
+
+// readBatch returns the events of the batch with the given name
+func readBatch(name string) (events, error) {
+	var batch EventBatch
+	var data events
+	if DB == nil {
+		return data, fmt.Errorf("Failed to get batch, invalid DB Connection")
+	}
+	if err := DB.First(&batch, "name = ?", name).Error; err != nil {
+		return data, fmt.Errorf("Failed to get batch %s: %v", name, err)
+	}
+	if err := json.Unmarshal([]byte(batch.Data), &data); err != nil {
+		return data, fmt.Errorf("Failed to get batch %s, invalid JSON: %v", name, err)
+	}
+	rows := []BatchEvents{}
+	if err := DB.Where("batch_id = ?", batch.ID).Order("id").Find(&rows).Error; err != nil {
+		return data, fmt.Errorf("Failed to get batch %s: %v", name, err)
+	}
+	if err := joinEvents(&data, rows); err != nil {
+		return data, fmt.Errorf("Failed to get batch %s, invalid JSON: %v", name, err)
+	}
+	return data, nil
+}
+
+// batchKinds returns the lists of events of e that are stored in BatchEvents rows, by the
+// kind of the rows
+func batchKinds(e *events) map[string]interface{} {
+	return map[string]interface{}{
+		"opened":          &e.Opened,
+		"closed":          &e.Closed,
+		"reopened":        &e.Reopened,
+		"comments":        &e.Comments,
+		"pulls_opened":    &e.PullsOpened,
+		"pulls_merged":    &e.PullsMerged,
+		"pulls_closed":    &e.PullsClosed,
+		"review_requests": &e.ReviewRequests,
+		"reviews":         &e.Reviews,
+		"review_comments": &e.ReviewComments,
+		"releases":        &e.Releases,
+		"forks":           &e.Forks,
+	}
+}
+
+// splitEvents moves the lists of events of e to BatchEvents rows of each kind, in their
+// order, and leaves the rest of e to be stored with the EventBatch
+func splitEvents(e *events) ([]BatchEvents, error) {
+	rows := []BatchEvents{}
+	for kind, list := range batchKinds(e) {
+		v := reflect.ValueOf(list).Elem()
+		for i := 0; i < v.Len(); i += batchRowEvents {
+			end := i + batchRowEvents
+			if end > v.Len() {
+				end = v.Len()
+			}
+			data, err := json.Marshal(v.Slice(i, end).Interface())
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, BatchEvents{Kind: kind, Data: string(data)})
+		}
+		v.Set(reflect.Zero(v.Type()))
+	}
+	return rows, nil
+}
+
+// joinEvents adds the events of rows stored by splitEvents to the lists of e
+func joinEvents(e *events, rows []BatchEvents) error {
+	kinds := batchKinds(e)
+	for _, row := range rows {
+		list, ok := kinds[row.Kind]
+		if !ok {
+			return fmt.Errorf("unknown kind of events %q", row.Kind)
+		}
+		v := reflect.ValueOf(list).Elem()
+		part := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(row.Data), part.Interface()); err != nil {
+			return err
+		}
+		v.Set(reflect.AppendSlice(v, part.Elem()))
+	}
+	return nil
+}
+
+// GetAllSubscriptions retrieves the subscriptions of all users
+func GetAllSubscriptions() ([]Subscription, error) {
+	results := []Subscription{}
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get subscriptions, invalid DB Connection")
+	}
+	err := DB.Preload("EmailPreference").Preload("Filter").Find(&results).Error
+	return results, err
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitEvents(t *testing.T) {
+	a, b := "https://api.github.com/repos/a/a", "https://api.github.com/repos/b/b"
+	data := events{
+		Opened:   []Issue{{Number: 1, Repo: a}, {Number: 2, Repo: b}, {Number: 3, Repo: a}},
+		Comments: []Comment{{ID: 4, Repo: b}},
+		Stars:    map[string]int{"a/a": 2},
+	}
+	for i := 0; i < batchRowEvents+1; i++ {
+		data.Forks = append(data.Forks, Fork{ID: int64(i), Repo: a})
+	}
+	want := data
+	rows, err := splitEvents(&data)
+	if err != nil {
+		t.Fatalf("splitEvents() failed: %v", err)
+	}
+	// Rows of issues and comments, and forks split in two rows
+	if len(rows) != 4 {
+		t.Errorf("splitEvents() got %d rows, wanted 4", len(rows))
+	}
+	if len(data.Opened) != 0 || len(data.Forks) != 0 || data.Stars["a/a"] != 2 {
+		t.Errorf("splitEvents() left %v, wanted only the stars", data)
+	}
+	if err := joinEvents(&data, rows); err != nil {
+		t.Fatalf("joinEvents() failed: %v", err)
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("joinEvents() got %v, wanted %v in the same order", data, want)
+	}
+	if err := joinEvents(&data, []BatchEvents{{Kind: "unknown", Data: "[]"}}); err == nil {
+		t.Errorf("joinEvents() got no error for an unknown kind")
+	}
+}
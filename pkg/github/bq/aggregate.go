@@ -0,0 +1,61 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+// Aggregate helpers format fields for use with GroupBy and Having. They use functions
+// that are available in both Legacy and Standard SQL.
+
+// Count formats field as COUNT(field), Count("*") counts all rows in a group
+func Count(field string) string {
+	return "COUNT(" + field + ")"
+}
+
+// CountDistinct formats field as COUNT(DISTINCT field)
+//
+// Legacy SQL returns an estimate when there are more than 1000 distinct values
+func CountDistinct(field string) string {
+	return "COUNT(DISTINCT " + field + ")"
+}
+
+// Min formats field as MIN(field)
+func Min(field string) string {
+	return "MIN(" + field + ")"
+}
+
+// Max formats field as MAX(field)
+func Max(field string) string {
+	return "MAX(" + field + ")"
+}
+
+// Timestamp formats field as TIMESTAMP(field), which converts a string such as a
+// JSON extracted date into a timestamp for use with Min and Max
+//
+// For Example: Max(Timestamp(JExtract("payload", "issue.updated_at")))
+func Timestamp(field string) string {
+	return "TIMESTAMP(" + field + ")"
+}
+
+// CountIf returns an expression that counts the rows of a group which match c
+//
+// For Example: CountIf(In("type", "IssuesEvent")) results in SUM(IF(type IN ?, 1, 0))
+func CountIf(c Condition) Condition {
+	return Expr("SUM(IF("+c.Expr+", 1, 0))", c.Args...)
+}
+
+// CountDistinctIf returns an expression that counts the distinct values of field for the
+// rows of a group which match c
+func CountDistinctIf(field string, c Condition) Condition {
+	return Expr(CountDistinct("IF("+c.Expr+", "+field+", NULL)"), c.Args...)
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/appengine/log"
+)
+
+// Budget limits the number of bytes that queries run by Fetch are allowed to scan
+//
+// When a limit is set, Fetch runs a dry-run of every query first and refuses to run
+// queries whose estimate is over budget with a *BudgetError
+type Budget struct {
+	QueryBytes int64 // maximum estimated bytes for a single query, 0 for no limit
+	DailyBytes int64 // maximum bytes scanned by all queries in a day, 0 for no limit
+	Usage      Usage // records bytes scanned per day, required for DailyBytes
+}
+
+// Usage stores the number of bytes scanned by queries per day, days are formatted
+// as YYYYMMDD in the America/Los_Angeles timezone used by BigQuery quotas
+type Usage interface {
+	Scanned(ctx context.Context, day string) (int64, error)
+	Add(ctx context.Context, day string, bytes int64) error
+}
+
+// DefaultBudget is the budget used by Fetch, limits are read from the
+// BIGQUERY_QUERY_BYTES_LIMIT and BIGQUERY_DAILY_BYTES_LIMIT environment variables
+var DefaultBudget = Budget{
+	QueryBytes: bytesFromEnv("BIGQUERY_QUERY_BYTES_LIMIT"),
+	DailyBytes: bytesFromEnv("BIGQUERY_DAILY_BYTES_LIMIT"),
+}
+
+// BudgetError is returned by Fetch when a query is refused for exceeding the Budget
+type BudgetError struct {
+	Estimate int64 // estimated bytes to be scanned by the query
+	Limit    int64 // limit that the query would exceed
+	Scanned  int64 // bytes scanned today, only set when the daily limit is exceeded
+	Daily    bool  // true if the daily limit is exceeded, false for the per query limit
+}
+
+func (e *BudgetError) Error() string {
+	if e.Daily {
+		return fmt.Sprintf("BigQuery daily budget exceeded: estimate %d bytes, "+
+			"scanned today %d bytes, limit %d bytes", e.Estimate, e.Scanned, e.Limit)
+	}
+	return fmt.Sprintf("BigQuery query budget exceeded: estimate %d bytes, limit %d bytes",
+		e.Estimate, e.Limit)
+}
+
+// limited returns true if the budget has a limit and queries need a dry-run
+func (b Budget) limited() bool {
+	return b.QueryBytes > 0 || b.DailyBytes > 0
+}
+
+// allow returns a *BudgetError if a query with the estimated bytes can't run
+// when scanned bytes have already been used today
+func (b Budget) allow(estimate, scanned int64) error {
+	if b.QueryBytes > 0 && estimate > b.QueryBytes {
+		return &BudgetError{Estimate: estimate, Limit: b.QueryBytes}
+	}
+	if b.DailyBytes > 0 && scanned+estimate > b.DailyBytes {
+		return &BudgetError{Estimate: estimate, Limit: b.DailyBytes, Scanned: scanned,
+			Daily: true}
+	}
+	return nil
+}
+
+// check runs query as a dry-run and compares its estimate against the budget
+func (b Budget) check(ctx context.Context, query *bigquery.Query) error {
+	if !b.limited() {
+		return nil
+	}
+	dryRun := *query
+	dryRun.DryRun = true
+	job, err := dryRun.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status := job.LastStatus()
+	if status == nil || status.Statistics == nil {
+		return fmt.Errorf("BigQuery dry-run returned no statistics")
+	}
+	estimate := status.Statistics.TotalBytesProcessed
+	log.Infof(ctx, "BigQuery dry-run estimate: %d bytes", estimate)
+
+	var scanned int64
+	if b.DailyBytes > 0 && b.Usage != nil {
+		if scanned, err = b.Usage.Scanned(ctx, Today()); err != nil {
+			log.Errorf(ctx, "Failed to get BigQuery usage: %v", err)
+		}
+	}
+	if err := b.allow(estimate, scanned); err != nil {
+		log.Warningf(ctx, "Query refused: %v", err)
+		return err
+	}
+	return nil
+}
+
+// record adds the bytes processed by a completed job to today's usage
+func (b Budget) record(ctx context.Context, status *bigquery.JobStatus) {
+	if b.Usage == nil || status.Statistics == nil {
+		return
+	}
+	bytes := status.Statistics.TotalBytesProcessed
+	if err := b.Usage.Add(ctx, Today(), bytes); err != nil {
+		log.Errorf(ctx, "Failed to record BigQuery usage of %d bytes: %v", bytes, err)
+	}
+}
+
+// Today returns the current day in the format used for recording Usage
+func Today() string {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	return time.Now().In(usLoc).Format("20060102")
+}
+
+// bytesFromEnv returns the number of bytes set in the environment variable key or 0
+func bytesFromEnv(key string) int64 {
+	bytes, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return bytes
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"testing"
+)
+
+var budgetTests = []struct {
+	testcase string
+	budget   Budget
+	estimate int64 // estimated bytes for the query
+	scanned  int64 // bytes scanned today
+	want     *BudgetError
+}{
+	{
+		"Case: No limits",
+		Budget{},
+		1 << 40,
+		1 << 40,
+		nil,
+	},
+	{
+		"Case: Within limits",
+		Budget{QueryBytes: 100, DailyBytes: 1000},
+		100,
+		900,
+		nil,
+	},
+	{
+		"Case: Query limit exceeded",
+		Budget{QueryBytes: 100, DailyBytes: 1000},
+		101,
+		0,
+		&BudgetError{Estimate: 101, Limit: 100},
+	},
+	{
+		"Case: Daily limit exceeded",
+		Budget{QueryBytes: 100, DailyBytes: 1000},
+		100,
+		901,
+		&BudgetError{Estimate: 100, Limit: 1000, Scanned: 901, Daily: true},
+	},
+}
+
+// TestBudget checks that queries over budget are refused with a BudgetError
+func TestBudget(t *testing.T) {
+	for _, tt := range budgetTests {
+		err := tt.budget.allow(tt.estimate, tt.scanned)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("\n%v\nBudget.allow() failed with unexpected error: %v", tt.testcase, err)
+			}
+			continue
+		}
+		got, ok := err.(*BudgetError)
+		if !ok || *got != *tt.want {
+			t.Errorf("\n%v\nBudget.allow() gave a wrong result:\nWant:\n %v\nGot:\n %v\n",
+				tt.testcase, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect selects the BigQuery SQL dialect that a SelectBuilder renders
+type Dialect int
+
+// Supported SQL dialects, Standard SQL is used unless a builder asks for Legacy SQL
+const (
+	Standard Dialect = iota // https://cloud.google.com/bigquery/docs/reference/standard-sql/
+	Legacy                  // https://cloud.google.com/bigquery/docs/reference/legacy-sql
+)
+
+// Table is a table to select from. It either names a single table, or a range of
+// date sharded tables such as githubarchive.day.YYYYMMDD when Start and End are set
+type Table struct {
+	Name  string    // full table name, or the table prefix for a date range
+	Start time.Time // first day of the date range
+	End   time.Time // last day of the date range
+}
+
+// DateRange returns a Table covering all daily tables named prefix+YYYYMMDD from start to end
+//
+// For Example: DateRange("githubarchive.day.", start, end) is rendered as
+// `githubarchive.day.*` with a _TABLE_SUFFIX condition in Standard SQL and as
+// TABLE_DATE_RANGE([githubarchive.day.], ...) in Legacy SQL
+func DateRange(prefix string, start, end time.Time) Table {
+	return Table{Name: prefix, Start: start, End: end}
+}
+
+// isRange returns true if the table is a range of date sharded tables
+func (t Table) isRange() bool {
+	return !t.Start.IsZero() && !t.End.IsZero()
+}
+
+// render returns the table reference to use in a FROM clause for the dialect d
+func (t Table) render(d Dialect) string {
+	if d == Legacy {
+		if t.isRange() {
+			return fmt.Sprintf("(TABLE_DATE_RANGE([%s],TIMESTAMP('%s'),TIMESTAMP('%s')))",
+				t.Name, t.Start.Format("2006-01-02"), t.End.Format("2006-01-02"))
+		}
+		return "[" + t.Name + "]"
+	}
+	if t.isRange() {
+		return "`" + t.Name + "*`"
+	}
+	return "`" + t.Name + "`"
+}
+
+// suffixCondition returns the _TABLE_SUFFIX condition limiting a wildcard table to its
+// date range in Standard SQL
+func (t Table) suffixCondition() Condition {
+	return Expr("_TABLE_SUFFIX BETWEEN ? AND ?",
+		t.Start.Format("20060102"), t.End.Format("20060102"))
+}
+
+// bindParams replaces the "?" placeholders in expr with values from params for dialect d.
+// A "?" within a quoted string or identifier, such as a JSON path, isn't a placeholder.
+//
+// Standard SQL keeps the placeholders and returns params to be sent as query parameters,
+// lists are expanded with UNNEST. Legacy SQL has no query parameters, so values are
+// written into the query as escaped literals and no params are returned.
+func bindParams(d Dialect, expr string, params []interface{}) (string, []interface{}, error) {
+	positions := placeholders(expr)
+	if len(positions) != len(params) {
+		return "", nil, fmt.Errorf("Query has %d placeholders but %d parameters",
+			len(positions), len(params))
+	}
+	if len(params) == 0 {
+		return expr, nil, nil
+	}
+	bound := &bytes.Buffer{}
+	last := 0
+	for i, p := range params {
+		bound.WriteString(expr[last:positions[i]])
+		last = positions[i] + 1
+		if d == Legacy {
+			literal, err := legacyLiteral(p)
+			if err != nil {
+				return "", nil, err
+			}
+			bound.WriteString(literal)
+		} else if _, ok := p.([]string); ok {
+			bound.WriteString("UNNEST(?)")
+		} else {
+			bound.WriteString("?")
+		}
+	}
+	bound.WriteString(expr[last:])
+	if d == Legacy {
+		return bound.String(), nil, nil
+	}
+	return bound.String(), params, nil
+}
+
+// placeholders returns the positions of the "?" placeholders in expr, skipping quoted
+// strings and identifiers and their backslash escapes
+func placeholders(expr string) []int {
+	var positions []int
+	var quote byte // quote character of the current string or identifier, 0 outside
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++ // skip the escaped character
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// legacyLiteral formats v as a Legacy SQL literal, lists of strings are formatted
+// as ('x','y','z') for use with IN
+func legacyLiteral(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return quoteString(value), nil
+	case []string:
+		list := make([]string, len(value))
+		for i, s := range value {
+			list[i] = quoteString(s)
+		}
+		return "(" + strings.Join(list, ",") + ")", nil
+	case int, int64, uint64, bool:
+		return fmt.Sprintf("%v", value), nil
+	case time.Time:
+		return "TIMESTAMP(" + quoteString(value.UTC().Format(time.RFC3339)) + ")", nil
+	}
+	return "", fmt.Errorf("Unsupported Legacy SQL parameter type: %T", v)
+}
+
+// quoteString returns s as a single quoted SQL string literal
+func quoteString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
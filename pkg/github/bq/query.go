@@ -24,8 +24,10 @@ import (
 	"google.golang.org/appengine/log"
 )
 
-// queryFetcher fetches results from bigquery using the queryString
-func queryFetcher(ctx context.Context, queryStr string) (*bigquery.RowIterator, error) {
+// queryFetcher fetches results from bigquery using the queryString in the given dialect and
+// binds params to the positional parameters in the query
+func queryFetcher(ctx context.Context, queryStr string, params []interface{},
+	dialect Dialect) (*bigquery.RowIterator, error) {
 
 	projectID := appengine.AppID(ctx)
 	client, err := bigquery.NewClient(ctx, projectID)
@@ -33,23 +35,41 @@ func queryFetcher(ctx context.Context, queryStr string) (*bigquery.RowIterator,
 		return nil, err
 	}
 	query := client.Query(queryStr)
-	query.QueryConfig.UseStandardSQL = false
+	for _, p := range params {
+		query.QueryConfig.Parameters = append(query.QueryConfig.Parameters,
+			bigquery.QueryParameter{Value: p})
+	}
+	query.QueryConfig.UseStandardSQL = dialect == Standard
 	query.QueryConfig.DisableQueryCache = false
-	results, err := query.Read(ctx)
+	if err := DefaultBudget.check(ctx, query); err != nil {
+		log.Errorf(ctx, "Query: %v, Params: %v", queryStr, params)
+		return nil, err
+	}
+	job, err := query.Run(ctx)
+	if err == nil {
+		var status *bigquery.JobStatus
+		if status, err = job.Wait(ctx); err == nil {
+			DefaultBudget.record(ctx, status)
+			err = status.Err()
+		}
+	}
 	if err != nil {
-		log.Errorf(ctx, "Query: %v", queryStr)
+		log.Errorf(ctx, "Query: %v, Params: %v", queryStr, params)
 		log.Errorf(ctx, "BigQuery Error:"+err.Error())
 		return nil, err
 	}
-	return results, err
+	return job.Read(ctx)
 }
 
 // Fetch executes a BigQuery Job using the supplied context, SelectBuilder
 // and returns a row iterator with results.
+//
+// Queries are checked against DefaultBudget before they run, a *BudgetError is returned
+// for queries that are over budget.
 func Fetch(ctx context.Context, sb SelectBuilder) (*bigquery.RowIterator, error) {
-	queryStr, err := sb.SQL()
+	queryStr, params, dialect, err := sb.sqlWithParams()
 	if err != nil {
 		return nil, err
 	}
-	return queryFetcher(ctx, queryStr)
+	return queryFetcher(ctx, queryStr, params, dialect)
 }
@@ -34,39 +34,122 @@ type Pair struct {
 // Columns Stores an array of Column Name,Label Pairs.
 type Columns []Pair
 
+// Condition holds an expression for use in a WHERE clause along with the values for
+// the positional query parameters ("?") that appear in the expression
+//
+// Values are sent to BigQuery as query parameters instead of being written into the
+// query string, which makes them safe to use with user supplied input
+type Condition struct {
+	Expr string        // SQL expression with a "?" placeholder for every value in Args
+	Args []interface{} // values for the placeholders in Expr, in order of appearance
+}
+
+// Expr returns a Condition for a raw expression with optional placeholder values
+//
+// For Example: Expr("stars > ?", 10) results in "stars > ?" with 10 as a query parameter
+func Expr(expr string, args ...interface{}) Condition {
+	return Condition{Expr: expr, Args: args}
+}
+
 // selectComponents builds a BigQuery query string for executing a select query on BigQuery
+//
+// Fields, conditions and havings keep the values of their own placeholders, so that each
+// is bound separately and a "?" in one of them can't shift the values of the others
 type selectComponents struct {
-	Fields     []string // holds the set of fields for use with select clause
-	Tables     []string // holds the list of tables to query from
-	Conditions []string // holds the list of conditions to use
-	OrderBys   []string // field to apply Order By clause
-	Limit      string   // Limit number of rows in result set
+	Dialect    Dialect     // SQL dialect to render the query in
+	Fields     []Condition // holds the set of fields for use with select clause
+	Tables     []Table     // holds the list of tables to query from
+	Conditions []Condition // holds the list of conditions to use, with their operators
+	GroupBys   []string    // fields to apply Group By clause
+	Havings    []Condition // holds the list of conditions on groups to use
+	OrderBys   []string    // field to apply Order By clause
+	Limit      string      // Limit number of rows in result set
 }
 
-// SQL returns a formatted query for use with BigQuery's Legacy SQL Dialect
-func (s *selectComponents) SQL() (query string, err error) {
+// bindAll binds the placeholders of each of clauses for dialect d and returns the bound
+// expressions along with the values of their query parameters in order
+func bindAll(d Dialect, clauses []Condition) ([]string, []interface{}, error) {
+	var exprs []string
+	var params []interface{}
+	for _, c := range clauses {
+		expr, p, err := bindParams(d, c.Expr, c.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		exprs = append(exprs, expr)
+		params = append(params, p...)
+	}
+	return exprs, params, nil
+}
+
+// SQL returns a formatted query for use with BigQuery's Legacy or Standard SQL Dialect
+// along with the values of the query parameters used in the query
+func (s *selectComponents) SQL() (query string, params []interface{}, err error) {
 	if len(s.Fields) == 0 {
 		err := fmt.Errorf("Select statement must have at least one field")
-		return "", err
+		return "", nil, err
 	}
 	if len(s.Tables) == 0 {
 		err := fmt.Errorf("Select statement must have at least one target table")
-		return "", err
+		return "", nil, err
+	}
+	if s.Dialect == Standard && len(s.Tables) > 1 {
+		err := fmt.Errorf("Standard SQL select statement must have only one target table")
+		return "", nil, err
 	}
 	rawQuery := &bytes.Buffer{}
 
 	// Add column(s)
+	fields, fieldParams, err := bindAll(s.Dialect, s.Fields)
+	if err != nil {
+		return "", nil, err
+	}
 	rawQuery.WriteString("SELECT ")
-	rawQuery.WriteString(strings.Join(s.Fields, ", "))
+	rawQuery.WriteString(strings.Join(fields, ", "))
 
 	// Add table(s)
+	tables := []string{}
+	for _, t := range s.Tables {
+		tables = append(tables, t.render(s.Dialect))
+	}
 	rawQuery.WriteString(" FROM ")
-	rawQuery.WriteString(strings.Join(s.Tables, ", "))
+	rawQuery.WriteString(strings.Join(tables, ", "))
 
 	// Add where clauses
-	if len(s.Conditions) > 0 {
+	bound, whereParams, err := bindAll(s.Dialect, s.Conditions)
+	if err != nil {
+		return "", nil, err
+	}
+	conditions := strings.Join(bound, " ")
+	if t := s.Tables[0]; s.Dialect == Standard && t.isRange() {
+		// Wildcard tables are limited to the date range with a _TABLE_SUFFIX condition
+		suffix, suffixParams, err := bindAll(s.Dialect, []Condition{t.suffixCondition()})
+		if err != nil {
+			return "", nil, err
+		}
+		if len(conditions) != 0 {
+			conditions = "(" + conditions + ") AND "
+		}
+		conditions = conditions + suffix[0]
+		whereParams = append(whereParams, suffixParams...)
+	}
+	if len(conditions) > 0 {
 		rawQuery.WriteString(" WHERE ")
-		rawQuery.WriteString(strings.Join(s.Conditions, " "))
+		rawQuery.WriteString(conditions)
+	}
+
+	// Add Group By and Having clauses
+	if len(s.GroupBys) > 0 {
+		rawQuery.WriteString(" GROUP BY ")
+		rawQuery.WriteString(strings.Join(s.GroupBys, ", "))
+	}
+	havings, havingParams, err := bindAll(s.Dialect, s.Havings)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(havings) > 0 {
+		rawQuery.WriteString(" HAVING ")
+		rawQuery.WriteString(strings.Join(havings, " AND "))
 	}
 
 	// Add Order By clauses
@@ -81,10 +164,19 @@ func (s *selectComponents) SQL() (query string, err error) {
 		rawQuery.WriteString(s.Limit)
 	}
 
-	return rawQuery.String(), nil
+	// Placeholders appear in the order of select, where and having clauses
+	params = append(params, fieldParams...)
+	params = append(params, whereParams...)
+	params = append(params, havingParams...)
+	if s.Dialect == Legacy {
+		// Legacy SQL values are written into the query
+		return rawQuery.String(), nil, nil
+	}
+	return rawQuery.String(), params, nil
 }
 
-// SelectBuilder is an exported Builder that allows users to build Legacy SQL queries on BigQuery
+// SelectBuilder is an exported Builder that allows users to build Standard or Legacy SQL
+// queries on BigQuery
 type SelectBuilder builder.Builder
 
 func init() {
@@ -100,7 +192,7 @@ func init() {
 // Column key and JSON field name as second argument
 func (b SelectBuilder) Select(cols Columns, args ...string) SelectBuilder {
 
-	var fields []string
+	var fields []Condition
 	for _, col := range cols {
 		field := col.Key
 		if len(args) == 1 {
@@ -110,93 +202,190 @@ func (b SelectBuilder) Select(cols Columns, args ...string) SelectBuilder {
 		if len(col.Value) != 0 {
 			field = field + " " + col.Value
 		}
-		fields = append(fields, field)
+		fields = append(fields, Expr(field))
 	}
 	return builder.Extend(b, "Fields", fields).(SelectBuilder)
 }
 
+// SelectAs adds the expression e with label to the list of columns to select, any values
+// in e.Args are passed as query parameters
+//
+// For Example: SelectAs(CountIf(In("type", "IssuesEvent")), "issues") results in
+// SELECT SUM(IF(type IN UNNEST(?), 1, 0)) issues
+func (b SelectBuilder) SelectAs(e Condition, label string) SelectBuilder {
+	field := e.Expr
+	if len(label) != 0 {
+		field = field + " " + label
+	}
+	return builder.Append(b, "Fields", Expr(field, e.Args...)).(SelectBuilder)
+}
+
 // SelectAll sets Fields in the selectComponents to "*", which results in a
 // "SELECT * FROM..." like query
 func (b SelectBuilder) SelectAll() SelectBuilder {
-	return builder.Set(b, "Fields", []string{"*"}).(SelectBuilder)
+	return builder.Set(b, "Fields", []Condition{Expr("*")}).(SelectBuilder)
 }
 
 // From adds all strings in names to use as tables in the query
 func (b SelectBuilder) From(names ...string) SelectBuilder {
-	var tables []string
+	var tables []Table
 	for _, s := range names {
-		if len(s) != 0 {
-			tables = append(tables, s)
+		tables = append(tables, Table{Name: s})
+	}
+	return b.FromTables(tables...)
+}
+
+// FromTables adds all tables to use as tables in the query, including date ranges
+// created using DateRange
+func (b SelectBuilder) FromTables(tables ...Table) SelectBuilder {
+	var valid []Table
+	for _, t := range tables {
+		if len(t.Name) != 0 {
+			valid = append(valid, t)
 		}
 	}
-	return builder.Extend(b, "Tables", tables).(SelectBuilder)
+	return builder.Extend(b, "Tables", valid).(SelectBuilder)
+}
+
+// Dialect sets the SQL dialect used by SQL to render the query, Standard SQL is used
+// by default
+func (b SelectBuilder) Dialect(d Dialect) SelectBuilder {
+	return builder.Set(b, "Dialect", d).(SelectBuilder)
 }
 
 // Where adds condition to the b.Condition.
 // If previous conditions exist, it behaves like b.And(condition)
-func (b SelectBuilder) Where(condition string) SelectBuilder {
+func (b SelectBuilder) Where(condition Condition) SelectBuilder {
+	if len(condition.Expr) == 0 {
+		return b
+	}
 	if _, ok := builder.Get(b, "Conditions"); ok {
 		// Other conditions exists, so we append with And Clause
 		return b.And(condition)
 	}
-	return builder.Extend(b, "Conditions", []string{condition}).(SelectBuilder)
+	return builder.Append(b, "Conditions", condition).(SelectBuilder)
 }
 
-// addCondition adds all strings in clauses to b.Conditions with the given condition operator
-func (b SelectBuilder) addCondition(operator string, clauses ...string) SelectBuilder {
-
+// addCondition adds all conditions in clauses to b.Conditions with the given condition operator
+func (b SelectBuilder) addCondition(operator string, clauses ...Condition) SelectBuilder {
+	if len(clauses) == 0 {
+		return b
+	}
 	if _, ok := builder.Get(b, "Conditions"); !ok {
 		// When no condition has been added, omit the operator for first condition
 		return b.Where(clauses[0]).addCondition(operator, clauses[1:]...)
 	}
 
-	for i, s := range clauses {
-		if len(s) != 0 {
-			clauses[i] = operator + s
+	var conditions []Condition
+	for _, c := range clauses {
+		if len(c.Expr) != 0 {
+			conditions = append(conditions, Expr(operator+c.Expr, c.Args...))
 		}
 	}
-	return builder.Extend(b, "Conditions", clauses).(SelectBuilder)
+	return builder.Extend(b, "Conditions", conditions).(SelectBuilder)
 }
 
-// And adds all strings in conditions to b.Conditions with an "AND" prefix
-func (b SelectBuilder) And(conditions ...string) SelectBuilder {
+// And adds all conditions to b.Conditions with an "AND" prefix
+func (b SelectBuilder) And(conditions ...Condition) SelectBuilder {
 	return b.addCondition("AND ", conditions...)
 }
 
-// listToStr is a helper method used by In and Like methods
-// converts strings x,y,z.. in list to ('x','y','z') and adds it to prefix
-func listToStr(prefix string, list ...string) string {
-	for i, s := range list {
-		list[i] = "'" + s + "'"
+// In can be used to write conditions of form "field IN (list of values)", where the list
+// of values is passed as a single array query parameter. In Standard SQL this results in
+// "field IN UNNEST(?)"
+func In(field string, values ...string) Condition {
+	return Expr(field+" IN ?", values)
+}
+
+// NotIn can be used to write conditions of form "field NOT IN (list of values)"
+func NotIn(field string, values ...string) Condition {
+	return Expr(field+" NOT IN ?", values)
+}
+
+// Like can be used to write conditions of form "(field LIKE ? OR field LIKE ? ...)", which
+// match if field matches any of the patterns
+func Like(field string, patterns ...string) Condition {
+	conditions := make([]Condition, len(patterns))
+	for i, p := range patterns {
+		conditions[i] = Expr(field+" LIKE ?", p)
 	}
-	return prefix + " (" + strings.Join(list, ",") + ")"
+	return Any(conditions...)
 }
 
-// In can be used to write conditions of form "field IN (list of values)"
-func In(field string, values ...string) string {
-	return listToStr(field+" IN", values...)
+// NotLike can be used to write conditions of form "(field NOT LIKE ? AND ...)", which
+// match if field matches none of the patterns
+func NotLike(field string, patterns ...string) Condition {
+	conditions := make([]Condition, len(patterns))
+	for i, p := range patterns {
+		conditions[i] = Expr(field+" NOT LIKE ?", p)
+	}
+	return All(conditions...)
 }
 
-// NotIn can be used to write conditions of form "field NOT IN (list of values)"
-func NotIn(field string, values ...string) string {
-	return listToStr(field+" NOT IN", values...)
+// group is a helper method used by All and Any
+// converts conditions x,y,z.. to "(x operator y operator z)" and keeps their values in order
+func group(operator string, conditions ...Condition) Condition {
+	var exprs []string
+	var args []interface{}
+	for _, c := range conditions {
+		if len(c.Expr) != 0 {
+			exprs = append(exprs, c.Expr)
+			args = append(args, c.Args...)
+		}
+	}
+	if len(exprs) == 0 {
+		return Condition{}
+	}
+	return Expr("("+strings.Join(exprs, " "+operator+" ")+")", args...)
+}
+
+// All returns a condition that matches when all of the conditions match
+//
+// For Example: Where(a).And(Any(b, c)) results in "a AND (b OR c)"
+func All(conditions ...Condition) Condition {
+	return group("AND", conditions...)
 }
 
-// Like can be used to write conditions form "field LIKE (list of values)"
-func Like(field string, values ...string) string {
-	return listToStr(field+" LIKE", values...)
+// Any returns a condition that matches when at least one of the conditions matches
+//
+// For Example: Where(Any(All(a, b), All(c, d))) results in "((a AND b) OR (c AND d))"
+func Any(conditions ...Condition) Condition {
+	return group("OR", conditions...)
 }
 
-// NotLike can be used to write conditions of form "field NOT LIKE (list of values)"
-func NotLike(field string, values ...string) string {
-	return listToStr(field+" NOT LIKE", values...)
+// Not returns a condition that matches when c does not match
+func Not(c Condition) Condition {
+	if len(c.Expr) == 0 {
+		return c
+	}
+	return Expr("NOT ("+c.Expr+")", c.Args...)
 }
 
-// Or adds all strings in conditions to b.Conditions with an "OR" prefix
-func (b SelectBuilder) Or(conditions ...string) SelectBuilder {
+// Or adds all conditions to b.Conditions with an "OR" prefix
+//
+// Conditions are not grouped, so Where(a).And(b).Or(c) results in "a AND b OR c". Use All,
+// Any and Not to build conditions with explicit grouping.
+func (b SelectBuilder) Or(conditions ...Condition) SelectBuilder {
 	return b.addCondition("OR ", conditions...)
 }
 
+// GroupBy adds all strings in fields to the Group By clause of the query
+func (b SelectBuilder) GroupBy(fields ...string) SelectBuilder {
+	return builder.Extend(b, "GroupBys", fields).(SelectBuilder)
+}
+
+// Having adds all conditions to the Having clause of the query joined with "AND", these
+// are applied to the groups created by GroupBy and may use aggregate functions
+func (b SelectBuilder) Having(conditions ...Condition) SelectBuilder {
+	var havings []Condition
+	for _, c := range conditions {
+		if len(c.Expr) != 0 {
+			havings = append(havings, c)
+		}
+	}
+	return builder.Extend(b, "Havings", havings).(SelectBuilder)
+}
+
 // OrderBy adds all strings in fields to b.SortFields separated by spaces
 func (b SelectBuilder) OrderBy(fields ...string) SelectBuilder {
 	return builder.Extend(b, "OrderBys", fields).(SelectBuilder)
@@ -208,10 +397,27 @@ func (b SelectBuilder) Limit(limit uint64) SelectBuilder {
 	return builder.Set(b, "Limit", fmt.Sprintf("%d", limit)).(SelectBuilder)
 }
 
-// SQL composes the query string to use with BigQuery's Legacy SQL standard
+// SQL composes the query string to use with BigQuery's Legacy or Standard SQL dialect
 func (b SelectBuilder) SQL() (string, error) {
 	components := builder.GetStruct(b).(selectComponents)
-	return components.SQL()
+	query, _, err := components.SQL()
+	return query, err
+}
+
+// sqlWithParams composes the query string along with the values for its query parameters
+func (b SelectBuilder) sqlWithParams() (string, []interface{}, Dialect, error) {
+	components := builder.GetStruct(b).(selectComponents)
+	query, params, err := components.SQL()
+	return query, params, components.Dialect, err
+}
+
+// Params returns the values of the positional query parameters used in the query, in the
+// order in which their placeholders appear in the query string returned by SQL.
+// Legacy SQL queries have no parameters as values are written into the query string.
+func (b SelectBuilder) Params() []interface{} {
+	components := builder.GetStruct(b).(selectComponents)
+	_, params, _ := components.SQL()
+	return params
 }
 
 // IsEmpty checks if the builder has any fields and returns true or false
@@ -222,12 +428,22 @@ func (b SelectBuilder) IsEmpty() bool {
 
 // JExtract formats a Column in a select query to use JSON_EXTRACT_SCALAR
 // As per https://cloud.google.com/bigquery/docs/reference/legacy-sql#json_extract_scalar
+// and https://cloud.google.com/bigquery/docs/reference/standard-sql/json_functions
+// which share the same syntax for JSONPath expressions with simple keys
 //
 // Example: JExtract('payload','action') ==> JSON_EXTRACT_SCALAR(payload,'$.action')
 func JExtract(json string, path string) string {
 	return fmt.Sprintf("JSON_EXTRACT_SCALAR(%s,'$.%s')", json, path)
 }
 
+// JExtractJSON formats a Column in a select query to use JSON_EXTRACT, which keeps
+// objects and arrays at path as a JSON string instead of returning NULL like JExtract
+//
+// Example: JExtractJSON('payload','issue.labels') ==> JSON_EXTRACT(payload,'$.issue.labels')
+func JExtractJSON(json string, path string) string {
+	return fmt.Sprintf("JSON_EXTRACT(%s,'$.%s')", json, path)
+}
+
 // Select acts as wrapper to easily start a new SelectBuilder Chain
 func Select(c Columns, args ...string) SelectBuilder {
 	return SelectBuilder{}.Select(c, args...)
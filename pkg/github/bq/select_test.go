@@ -14,9 +14,14 @@
 package bq
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
+var start = time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+var end = time.Date(2017, 7, 8, 0, 0, 0, 0, time.UTC)
+
 var queryTests = []struct {
 	testcase  string
 	query     SelectBuilder // SelectBuilder chain for the query
@@ -27,58 +32,234 @@ var queryTests = []struct {
 	{
 		"Case: Select field, From",
 		Select(Columns{{"field", "label"}}).From("table_name"),
-		"SELECT field label FROM table_name",
+		"SELECT field label FROM `table_name`",
 		"",
 	},
 	{
 		"Case: Select JSON_EXTRACT_Scalar path, From",
 		Select(Columns{{"key.subkey", "label"}}, "jsonkey").From("table_name"),
-		"SELECT JSON_EXTRACT_SCALAR(jsonkey,'$.key.subkey') label FROM table_name",
+		"SELECT JSON_EXTRACT_SCALAR(jsonkey,'$.key.subkey') label FROM `table_name`",
 		"",
 	},
 	{
 		"Case: Select * From",
 		SelectAll().From("table_name"),
-		"SELECT * FROM table_name",
+		"SELECT * FROM `table_name`",
 		"",
 	},
 	{
 		"Case: Select * From table_name Limit 10",
 		SelectAll().From("table_name").Limit(10),
-		"SELECT * FROM table_name LIMIT 10",
+		"SELECT * FROM `table_name` LIMIT 10",
 		"",
 	},
 	{
 		"Case: Select * From table_name Order By f",
 		SelectAll().From("table_name").OrderBy("f"),
-		"SELECT * FROM table_name ORDER BY f",
+		"SELECT * FROM `table_name` ORDER BY f",
 		"",
 	},
 	{
-		"Case: Select * From table_name WHERE x IN ('1','2','3')",
+		"Case: Select * From table_name WHERE x IN UNNEST(?)",
 		SelectAll().From("table_name").Where(In("x", "1", "2", "3")),
-		"SELECT * FROM table_name WHERE x IN ('1','2','3')",
+		"SELECT * FROM `table_name` WHERE x IN UNNEST(?)",
 		"",
 	},
 	{
 		"Case: Select with JSON Extracted field",
 		SelectAll().
 			From("user_favorites").
-			Where(JExtract("favorite", "movie.title") + " IN ('Hello World')"),
-		`SELECT * FROM user_favorites WHERE JSON_EXTRACT_SCALAR(favorite,'$.movie.title') ` +
-			`IN ('Hello World')`,
+			Where(In(JExtract("favorite", "movie.title"), "Hello World")),
+		"SELECT * FROM `user_favorites` WHERE JSON_EXTRACT_SCALAR(favorite,'$.movie.title') " +
+			"IN UNNEST(?)",
 		"",
 	},
 	{
 		"Case: Select f1,f2,f3 From table_name Where c1 AND c2 OR c3",
 		Select(Columns{{"f1", "l1"}}).Select(Columns{{"f2", "l2"}, {"f3", ""}}).
 			From("table_name").
-			Where("f1 IN ('xyz','qwerty')").
-			And("f2 LIKE ('%asdf%')").Or("f3 = '@'"),
-		`SELECT f1 l1, f2 l2, f3 FROM table_name WHERE f1 IN ('xyz','qwerty') AND f2 LIKE ` +
-			`('%asdf%') OR f3 = '@'`,
+			Where(In("f1", "xyz", "qwerty")).
+			And(Like("f2", "%asdf%")).Or(Expr("f3 = ?", "@")),
+		"SELECT f1 l1, f2 l2, f3 FROM `table_name` WHERE f1 IN UNNEST(?) AND (f2 LIKE ?) " +
+			"OR f3 = ?",
+		"",
+	},
+	{
+		"Case: Select * From table_name Where x LIKE any AND y NOT LIKE all",
+		SelectAll().From("table_name").
+			Where(Like("x", "a%", "b%")).
+			And(NotLike("y", "%c", "%d")),
+		"SELECT * FROM `table_name` WHERE (x LIKE ? OR x LIKE ?) AND " +
+			"(y NOT LIKE ? AND y NOT LIKE ?)",
+		"",
+	},
+	{
+		"Case: Select * From wildcard table for a date range",
+		SelectAll().FromTables(DateRange("githubarchive.day.", start, end)).
+			Where(In("type", "IssuesEvent")).Or(In("type", "IssueCommentEvent")),
+		"SELECT * FROM `githubarchive.day.*` WHERE (type IN UNNEST(?) OR type IN UNNEST(?)) " +
+			"AND _TABLE_SUFFIX BETWEEN ? AND ?",
+		"",
+	},
+	{
+		"Case: Legacy SQL Select field, From",
+		Select(Columns{{"field", "label"}}).From("table_name").Dialect(Legacy),
+		"SELECT field label FROM [table_name]",
 		"",
 	},
+	{
+		"Case: Legacy SQL Select * From table date range",
+		SelectAll().FromTables(DateRange("githubarchive.day.", start, end)).Dialect(Legacy),
+		"SELECT * FROM (TABLE_DATE_RANGE([githubarchive.day.],TIMESTAMP('2017-07-01')," +
+			"TIMESTAMP('2017-07-08')))",
+		"",
+	},
+	{
+		"Case: Legacy SQL writes escaped values into the query",
+		Select(Columns{{"f1", "l1"}}).
+			From("table_name").
+			Where(In("f1", "xyz", "it's")).
+			And(Like("f2", `%as\df%`)).Or(Expr("f3 > ?", 10)).
+			Dialect(Legacy),
+		`SELECT f1 l1 FROM [table_name] WHERE f1 IN ('xyz','it\'s') AND (f2 LIKE '%as\\df%') ` +
+			`OR f3 > 10`,
+		"",
+	},
+	{
+		"Case: Question marks in quoted strings aren't placeholders",
+		Select(Columns{{JExtract("payload", "issue.title"), "title"}}).
+			From("table_name").
+			Where(Expr("title LIKE '%?%'")).
+			And(Expr("`what?` = ?", "x")).
+			Dialect(Legacy),
+		"SELECT JSON_EXTRACT_SCALAR(payload,'$.issue.title') title FROM [table_name] " +
+			"WHERE title LIKE '%?%' AND `what?` = 'x'",
+		"",
+	},
+	{
+		"Case: Values with question marks don't shift later placeholders",
+		Select(Columns{{"f1", "l1"}}).
+			From("table_name").
+			Where(Expr("f1 = ?", "why?")).
+			And(Expr(`f2 = "a\"?"`)).
+			Or(Expr("f3 > ?", 10)).
+			Dialect(Legacy),
+		`SELECT f1 l1 FROM [table_name] WHERE f1 = 'why?' AND f2 = "a\"?" OR f3 > 10`,
+		"",
+	},
+	{
+		"Case: Select field, Count From table_name Group By field",
+		Select(Columns{{"repo.name", "repo"}, {Count("*"), "events"}}).
+			From("table_name").
+			GroupBy("repo"),
+		"SELECT repo.name repo, COUNT(*) events FROM `table_name` GROUP BY repo",
+		"",
+	},
+	{
+		"Case: Select JSON arrays along with scalars from payload",
+		Select(Columns{{"issue.id", "id"}}, "payload").
+			Select(Columns{{JExtractJSON("payload", "issue.labels"), "labels"}}).
+			From("table_name"),
+		"SELECT JSON_EXTRACT_SCALAR(payload,'$.issue.id') id, " +
+			"JSON_EXTRACT(payload,'$.issue.labels') labels FROM `table_name`",
+		"",
+	},
+	{
+		"Case: Select Min, Max timestamps Group By Having Order By",
+		Select(Columns{
+			{"actor.login", "author"},
+			{Min("created_at"), "first"},
+			{Max(Timestamp(JExtract("payload", "issue.updated_at"))), "last"},
+		}).
+			From("table_name").
+			GroupBy("author").
+			Having(Expr(Count("*")+" > ?", 5)).
+			OrderBy("last DESC"),
+		"SELECT actor.login author, MIN(created_at) first, " +
+			"MAX(TIMESTAMP(JSON_EXTRACT_SCALAR(payload,'$.issue.updated_at'))) last " +
+			"FROM `table_name` GROUP BY author HAVING COUNT(*) > ? ORDER BY last DESC",
+		"",
+	},
+	{
+		"Case: Per repo counts of opened and closed issues and distinct commenters",
+		Select(Columns{{"repo.name", "repo"}}).
+			SelectAs(CountIf(Expr(JExtract("payload", "action")+" = ?", "opened")), "opened").
+			SelectAs(CountIf(Expr(JExtract("payload", "action")+" = ?", "closed")), "closed").
+			SelectAs(CountDistinctIf("actor.login", In("type", "IssueCommentEvent")),
+				"commenters").
+			FromTables(DateRange("githubarchive.day.", start, end)).
+			Where(In("repo.name", "a/b", "c/d")).
+			GroupBy("repo").
+			Having(Expr(CountDistinct("actor.login")+" >= ?", 2), Expr("opened > 0")),
+		"SELECT repo.name repo, " +
+			"SUM(IF(JSON_EXTRACT_SCALAR(payload,'$.action') = ?, 1, 0)) opened, " +
+			"SUM(IF(JSON_EXTRACT_SCALAR(payload,'$.action') = ?, 1, 0)) closed, " +
+			"COUNT(DISTINCT IF(type IN UNNEST(?), actor.login, NULL)) commenters " +
+			"FROM `githubarchive.day.*` " +
+			"WHERE (repo.name IN UNNEST(?)) AND _TABLE_SUFFIX BETWEEN ? AND ? " +
+			"GROUP BY repo HAVING COUNT(DISTINCT actor.login) >= ? AND opened > 0",
+		"",
+	},
+	{
+		"Case: Legacy SQL Select aggregate with conditions",
+		Select(Columns{{"type", ""}}).
+			SelectAs(CountIf(In("actor.login", "x")), "by_x").
+			From("table_name").
+			Where(Expr("id > ?", 5)).
+			GroupBy("type").
+			Having(Expr("by_x > ?", 1)).
+			Dialect(Legacy),
+		"SELECT type, SUM(IF(actor.login IN ('x'), 1, 0)) by_x FROM [table_name] " +
+			"WHERE id > 5 GROUP BY type HAVING by_x > 1",
+		"",
+	},
+	{
+		"Case: Select * From table_name Where a AND (b OR c)",
+		SelectAll().From("table_name").
+			Where(Expr("a = ?", 1)).
+			And(Any(Expr("b = ?", 2), Expr("c = ?", 3))),
+		"SELECT * FROM `table_name` WHERE a = ? AND (b = ? OR c = ?)",
+		"",
+	},
+	{
+		"Case: Select * From table_name Where nested groups",
+		SelectAll().From("table_name").
+			Where(Any(
+				All(In("type", "IssuesEvent"), In("repo.name", "x/y")),
+				All(In("type", "IssueCommentEvent"), Not(In("repo.name", "x/y"))),
+			)),
+		"SELECT * FROM `table_name` WHERE ((type IN UNNEST(?) AND repo.name IN UNNEST(?)) OR " +
+			"(type IN UNNEST(?) AND NOT (repo.name IN UNNEST(?))))",
+		"",
+	},
+	{
+		"Case: Empty groups are skipped",
+		SelectAll().From("table_name").
+			Where(All()).
+			And(Any(Expr("a"), All(), Not(Any()))),
+		"SELECT * FROM `table_name` WHERE (a)",
+		"",
+	},
+	{
+		"Case: Legacy SQL Select * From table_name Where nested groups",
+		SelectAll().From("table_name").
+			Where(Not(Any(Expr("a = ?", "x"), All(Expr("b = ?", 1), Expr("c"))))).
+			Dialect(Legacy),
+		"SELECT * FROM [table_name] WHERE NOT ((a = 'x' OR (b = 1 AND c)))",
+		"",
+	},
+	{
+		"ErrorCase: for multiple tables in Standard SQL",
+		SelectAll().From("table_1", "table_2"),
+		"",
+		"Standard SQL select statement must have only one target table",
+	},
+	{
+		"ErrorCase: for mismatched query parameters",
+		SelectAll().From("table_name").Where(Expr("x = ? OR y = ?", 1)),
+		"",
+		"Query has 2 placeholders but 1 parameters",
+	},
 	{
 		"ErrorCase: for Empty From Clause",
 		SelectAll().From(""),
@@ -87,7 +268,7 @@ var queryTests = []struct {
 	},
 	{
 		"ErrorCase: for Missing From Clause",
-		SelectAll().Where("XYZ > 10"),
+		SelectAll().Where(Expr("XYZ > 10")),
 		"",
 		"Select statement must have at least one target table",
 	},
@@ -106,3 +287,82 @@ func TestSelectBuilder(t *testing.T) {
 		}
 	}
 }
+
+var paramTests = []struct {
+	testcase string
+	query    SelectBuilder // SelectBuilder chain for the query
+	want     []interface{} // Expected query parameters
+}{
+	{
+		"Case: No conditions",
+		SelectAll().From("table_name"),
+		nil,
+	},
+	{
+		"Case: In binds the list of values as one array parameter",
+		SelectAll().From("table_name").Where(In("x", "1", "2")),
+		[]interface{}{[]string{"1", "2"}},
+	},
+	{
+		"Case: Date ranges add the table suffixes as parameters",
+		SelectAll().FromTables(DateRange("githubarchive.day.", start, end)).
+			Where(In("x", "1")),
+		[]interface{}{[]string{"1"}, "20170701", "20170708"},
+	},
+	{
+		"Case: Parameters are kept in order of select, where and having clauses",
+		Select(Columns{{"repo.name", "repo"}}).
+			SelectAs(CountIf(Expr("type = ?", "IssuesEvent")), "issues").
+			From("table_name").
+			Having(Expr("issues > ?", 10)).
+			Where(Expr("id > ?", 5)).
+			GroupBy("repo"),
+		[]interface{}{"IssuesEvent", 5, 10},
+	},
+	{
+		"Case: Legacy SQL has no query parameters",
+		SelectAll().From("table_name").Where(In("x", "1")).Dialect(Legacy),
+		nil,
+	},
+	{
+		"Case: Parameters are kept in order of placeholders",
+		SelectAll().From("table_name").
+			Where(Expr("a = ?", 1)).
+			And(NotIn("b", "x"), Like("c", "%y", "z%")).
+			Or(Expr("d BETWEEN ? AND ?", 2, 3)),
+		[]interface{}{1, []string{"x"}, "%y", "z%", 2, 3},
+	},
+	{
+		"Case: Grouped conditions keep parameters in order",
+		SelectAll().From("table_name").
+			Where(Any(All(Expr("a = ?", 1), Expr("b = ?", 2)), Not(Expr("c = ?", 3)))),
+		[]interface{}{1, 2, 3},
+	},
+	{
+		"Case: Quoted question marks have no parameters",
+		SelectAll().From("table_name").
+			Where(Expr("title LIKE '%?%'")).
+			And(Expr("id > ?", 5)),
+		[]interface{}{5},
+	},
+	{
+		"Case: Quotes in values stay out of the query string",
+		SelectAll().From("table_name").Where(In("repo.name", "a') OR 1=1 --")),
+		[]interface{}{[]string{"a') OR 1=1 --"}},
+	},
+}
+
+// TestSelectParams checks that conditions carry their values as query parameters
+func TestSelectParams(t *testing.T) {
+	for _, tt := range paramTests {
+		if got := tt.query.Params(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("\n%v\nSelectBuilder.Params() gave a wrong result:\nWant:\n %v\nGot:\n %v\n",
+				tt.testcase, tt.want, got)
+		}
+	}
+	sql, _ := paramTests[len(paramTests)-1].query.SQL()
+	if want := "SELECT * FROM `table_name` WHERE repo.name IN UNNEST(?)"; sql != want {
+		t.Errorf("SelectBuilder.SQL() leaked a parameter value:\nWant:\n %v\nGot:\n %v\n",
+			want, sql)
+	}
+}
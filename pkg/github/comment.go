@@ -41,8 +41,9 @@ type Comment struct {
 	Author    string    // author's github login name
 	Created   time.Time // timestamp with date of creation
 	UpdatedAt time.Time // timestamp with last update
-	Repo      string    // API url for the Comment's parent repo
+	Repo      string    `gorm:"index;"` // API url for the Comment's parent repo
 	URL       string    // https url for the comment on github.com
+	More      int       `gorm:"-"` // number of other comments on the issue coalesced into this one
 }
 
 // CommentFetcher uses information stored to query the githubarchive dataset for comments
@@ -62,7 +63,7 @@ func (f *CommentFetcher) init() {
 		{"comment.created_at", "created"},
 		{"comment.html_url", "url"},
 	}, "payload").
-		From(f.Opts.getTables()...).
+		FromTables(f.Opts.getTables()...).
 		And(f.extractConditions()...).
 		OrderBy(f.Opts.getOrder()...).
 		Limit(f.Opts.getLimits())
@@ -71,20 +72,20 @@ func (f *CommentFetcher) init() {
 
 // extractConditions returns set conditions from f.Opts or the default set of conditions
 // for CommentFetcher to use
-func (f *CommentFetcher) extractConditions() []string {
+func (f *CommentFetcher) extractConditions() []bq.Condition {
 	// return set conditions if present
 	if len(f.Opts.Conditions) != 0 {
 		return f.Opts.Conditions
 	}
 	// return default conditions in other cases
-	conditions := []string{}
+	conditions := []bq.Condition{}
 
 	// Add default condition for IssuesEvents
 	conditions = append(conditions, bq.In("type", "IssueCommentEvent"))
 
 	// add condition for repositories to query from
 	if len(f.Opts.Repositories) != 0 {
-		conditions = append(conditions, bq.In("repo.name", f.Opts.Repositories...))
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
 	}
 
 	// Select only comments where are not deleted by default
@@ -143,16 +144,14 @@ func mapToComment(m map[string]bigquery.Value) Comment {
 	}
 }
 
-// Checks against Github's API to see if there were no comments on this repo for the given
-// frequency. Calls  api.github.com/:repo/issues/comments with a generated parameter
-// of the form ?since=YYYY-MM-DDT00:00:10Z based on email Frequency passed
-func checkNoComment(ctx context.Context, repo string, f Frequency) (bool, error) {
+// Checks against Github's API to see if there were no comments on this repo since the
+// start of the digest's window. Calls  api.github.com/:repo/issues/comments with a
+// parameter of the form ?since=YYYY-MM-DDTHH:MM:SSZ
+func checkNoComment(ctx context.Context, repo string, since time.Time) (bool, error) {
 
-	since := getCommentCheckTime(f).Format("2006-01-02")
-	since = since + "T00:00:10Z"
 	url := "repos/" + repo + "/issues/comments"
 	// Get comments from github
-	resp, err := API(ctx, url, "since="+since)
+	resp, err := API(ctx, url, "since="+since.UTC().Format(time.RFC3339))
 	if err != nil {
 		log.Errorf(ctx, "Error checking comments for repo %s: %v", repo, err)
 		return false, err
@@ -166,21 +165,6 @@ func checkNoComment(ctx context.Context, repo string, f Frequency) (bool, error)
 	return false, nil
 }
 
-func getCommentCheckTime(f Frequency) (since time.Time) {
-
-	usLoc, _ := time.LoadLocation("America/Los_Angeles")
-	today := time.Now().In(usLoc)
-	if f == Weekly {
-		weekStart := today.AddDate(0, 0, -7)
-		since = weekStart
-	} else if f == Monthly {
-		since = today.AddDate(0, -1, 0)
-	} else {
-		since = today.AddDate(0, 0, -1)
-	}
-	return
-}
-
 func trimBody(body string) string {
 	if len(body) < 120 {
 		return body
@@ -18,6 +18,7 @@ package github
 
 import (
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/internal/testutil"
@@ -45,8 +46,8 @@ func TestCommentFetcher(t *testing.T) {
 
 	fetcher := CommentFetcher{
 		Opts: Options{
-			Tables: []string{"ghissues.test_bed"},
-			Conditions: []string{
+			Tables: []bq.Table{{Name: "ghissues.test_bed"}},
+			Conditions: []bq.Condition{
 				bq.In("type", "IssueCommentEvent"),
 				bq.In("repo_name", "GoogleCloudPlatform/google-cloud-node"),
 				bq.In(bq.JExtract("payload", "action"), "created"),
@@ -83,7 +84,8 @@ func TestCheckNoComment(t *testing.T) {
 	req, err := inst.NewRequest("GET", "/", nil)
 	ctx := appengine.NewContext(req)
 
-	if val, err := checkNoComment(ctx, "arjun-rao/go-ae-starter", Daily); err != nil {
+	if val, err := checkNoComment(ctx, "arjun-rao/go-ae-starter",
+		NewWindow(Daily, time.Now()).Start); err != nil {
 		t.Errorf("checkNoComment() returned %v and failed with error: %v", val, err)
 	}
 
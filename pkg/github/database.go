@@ -17,6 +17,7 @@ package github
 import (
 	"log"
 
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/db"
 
 	"github.com/jinzhu/gorm"
@@ -32,22 +33,55 @@ func init() {
 	if DB == nil {
 		log.Panicf("Error migrating,  Invalid database connection")
 	}
+	if DB.HasTable(&Star{}) {
+		// Remove the stars that redelivered webhooks stored again before stars were unique
+		DB.Exec("DELETE s1 FROM stars s1 JOIN stars s2 " +
+			"ON s1.user = s2.user AND s1.repo = s2.repo AND s1.id > s2.id")
+	}
 	err := DB.AutoMigrate(
 		&User{},
 		&Repo{},
 		&Subscription{},
 		&EmailPreference{},
+		&Filter{},
+		&Team{},
+		&TeamMember{},
 		&Notification{},
+		&DigestMarker{},
+		&SentDigest{},
+		&QueryUsage{},
+		&EventBatch{},
+		&BatchEvents{},
+		&Issue{},
+		&Comment{},
+		&PullRequest{},
+		&Review{},
+		&Release{},
+		&Fork{},
+		&Star{},
 	).Error
 
 	if err != nil {
 		log.Panicf("Error migrating tables,%v", err)
 	} else {
 		DB.Model(&Subscription{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
-		DB.Model(&Subscription{}).AddUniqueIndex("idx_userid_repo", "user_id", "repo")
+		// A user can subscribe to a repo for themselves and for each of their teams
+		DB.Model(&Subscription{}).RemoveIndex("idx_userid_repo")
+		DB.Model(&Subscription{}).AddUniqueIndex("idx_userid_teamid_repo", "user_id", "team_id", "repo")
+		DB.Model(&TeamMember{}).AddForeignKey("team_id", "teams(id)", "CASCADE", "CASCADE")
+		DB.Model(&TeamMember{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
 		DB.Model(&EmailPreference{}).
 			AddForeignKey("subscription_id", "subscriptions(id)", "CASCADE", "CASCADE")
+		DB.Model(&Filter{}).
+			AddForeignKey("subscription_id", "subscriptions(id)", "CASCADE", "CASCADE")
 		DB.Model(&Notification{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+		DB.Model(&DigestMarker{}).
+			AddForeignKey("subscription_id", "subscriptions(id)", "CASCADE", "CASCADE")
+		// Flag the pull requests that webhooks stored as issues, by their github.com URL
+		DB.Model(&Issue{}).Where("url LIKE ? AND (pull_request = ? OR pull_request IS NULL)",
+			"%/pull/%", false).UpdateColumn("pull_request", true)
 
 	}
+	// Record bytes scanned by BigQuery for enforcing and reporting the query budget
+	bq.DefaultBudget.Usage = queryUsageStore{}
 }
@@ -16,19 +16,28 @@ package github
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"google.golang.org/appengine/log"
 
-	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
-
 	"golang.org/x/net/context"
 )
 
-type eventOptions map[string]Options
 type eventRepo map[string][]string
 
+// add appends repo to the list of repos for an event kind unless it is already listed, as
+// subscriptions of different users may share repos
+func (m eventRepo) add(event string, repo string) {
+	for _, r := range m[event] {
+		if r == repo {
+			return
+		}
+	}
+	m[event] = append(m[event], repo)
+}
+
 // Payload is the type that contains email data for one repo
 type Payload struct {
 	RepoName       string
@@ -37,50 +46,215 @@ type Payload struct {
 	Comments       []Comment
 	NoComment      bool
 	NoCommentSince time.Time
+	OpenPulls      []PullRequest
+	MergedPulls    []PullRequest
+	ClosedPulls    []PullRequest
+	ReviewRequests []PullRequest
+	Reviews        []Review // reviews and review comments
+	Releases       []Release
+	Forks          []Fork
+	NewStars       int // number of stars given to the repo
 }
 
 // EmailPayload is the type that contains email data for one Email to be sent
 type EmailPayload struct {
-	Email   string
-	Content []Payload
+	Email         string
+	Content       []Payload
+	Window        Window // time covered by the payload
+	Subscriptions []uint // IDs of the subscriptions composed into the payload
+}
+
+// events holds the GitHub activity fetched for a set of subscriptions
+type events struct {
+	Opened    []Issue
+	Closed    []Issue
+	Reopened  []Issue
+	Comments  []Comment
+	NoComment []string // repos without new comments
+
+	PullsOpened    []PullRequest
+	PullsMerged    []PullRequest
+	PullsClosed    []PullRequest
+	ReviewRequests []PullRequest
+	Reviews        []Review
+	ReviewComments []Review
+
+	Releases []Release
+	Forks    []Fork
+	Stars    map[string]int // number of stars by repo name
+
+	Window Window // time covered by the events
 }
 
 var ctx context.Context
 
-// FetchData constructs bigquery requests for fetching appropriate data for email notifications
-func FetchData(c context.Context,
+// FetchData fetches data for email notifications about subscriptions from source
+func FetchData(c context.Context, source EventSource,
 	subscriptions []Subscription, emailType Frequency) ([]EmailPayload, error) {
 
-	var errors error
 	//setup global context to use for logging
 	ctx = c
+	return FetchWindowData(ctx, source, subscriptions, emailType,
+		DigestWindow(source, subscriptions, emailType, time.Now()))
+}
+
+// FetchWindowData is like FetchData for the activity within window, such as the window of a
+// scheduled digest returned by DueDigests
+func FetchWindowData(c context.Context, source EventSource,
+	subscriptions []Subscription, emailType Frequency, window Window) ([]EmailPayload, error) {
+
+	//setup global context to use for logging
+	ctx = c
+	data, errors := fetchEvents(ctx, source, subscriptions, emailType, window,
+		fetchLimit(subscriptions))
+	return makePayloads(subscriptions, emailType, data), errors
+}
+
+// filteredLimit is the number of results of each event kind fetched for subscriptions
+// with filters, which are applied before the results are limited to defaultLimit
+const filteredLimit = 1000
+
+// fetchLimit returns the limit of results of each event kind to fetch for subscriptions,
+// 0 for the default. Filters drop fetched results, so more are fetched for them to leave
+// enough activity for the digest.
+func fetchLimit(subscriptions []Subscription) uint64 {
+	if newSubscriptionFilters(subscriptions).isEmpty() {
+		return 0
+	}
+	return filteredLimit
+}
+
+// fetchEvents gets all event kinds that subscriptions are interested in for emailType
+// within window from source. limit overrides the default limit of results for each event
+// kind if set.
+func fetchEvents(ctx context.Context, source EventSource, subscriptions []Subscription,
+	emailType Frequency, window Window, limit uint64) (events, error) {
+
+	var errors error
+	source = withSubscriptionSources(source, subscriptions)
 	eventReposMap := mapMaker(subscriptions, emailType)
-	// Get query options for using IssueFetcher and CommentFetcher
-	eventOptionsMap := optionMaker(eventReposMap, emailType)
-	// Call IssueFetcher for Open,Closed,Reopen []Issues
-	openIssues, err := fetchIssues(ctx, eventOptionsMap, "opened")
+	// Get Open,Closed,Reopen []Issues
+	openIssues, err := sourceIssues(ctx, source, eventReposMap["opened"], "opened", window, limit)
 
 	if err != nil {
 		log.Errorf(ctx, "Error fetching open issues: %v", err)
 		errors = fmt.Errorf("Error with Open Issues: %v", err)
 	}
-	closedIssues, err := fetchIssues(ctx, eventOptionsMap, "closed")
+	closedIssues, err := sourceIssues(ctx, source, eventReposMap["closed"], "closed", window, limit)
 	if err != nil {
 		log.Errorf(ctx, "Error fetching closed issues: %v", err)
 		errors = fmt.Errorf("%v\nError with Closed Issues: %v", errors, err)
 	}
-	reopenedIssues, err := fetchIssues(ctx, eventOptionsMap, "reopened")
+	reopenedIssues, err := sourceIssues(ctx, source, eventReposMap["reopened"], "reopened",
+		window, limit)
 	if err != nil {
 		log.Errorf(ctx, "Error fetching reopened issues: %v", err)
 		errors = fmt.Errorf("%v\nError with Reopened Issues: %v", errors, err)
 	}
 
-	// Call CommentFetcher for Comments
-	comments, err := fetchComments(ctx, eventOptionsMap["comment"])
+	// Get Comments
+	comments, err := sourceComments(ctx, source, eventReposMap["comment"], window, limit)
 	if err != nil {
 		log.Errorf(ctx, "Error fetching comments issues: %v", err)
 		errors = fmt.Errorf("%v\nError with Comments: %v", errors, err)
 	}
+	// Get list of repos with no comment
+	repoWithNoComment := []string{}
+	noCommentRepos, err := ExpandRepos(ctx, eventReposMap["nocomment"]...)
+	if err != nil {
+		log.Errorf(ctx, "Error listing repos to check for comments: %v", err)
+		errors = fmt.Errorf("%v\nError with No Comments: %v", errors, err)
+	}
+	for _, repo := range noCommentRepos {
+		if add, err := checkNoComment(ctx, repo, window.Start); add && err == nil {
+			repoWithNoComment = append(repoWithNoComment, repo)
+		}
+	}
+	log.Infof(ctx, "No Comments on: %v", repoWithNoComment)
+
+	// Get Opened, Merged, Closed and Review Requested []PullRequests
+	pulls := map[string][]PullRequest{}
+	for _, action := range []string{"opened", "merged", "closed", "review_requested"} {
+		pulls[action], err = sourcePullRequests(ctx, source, eventReposMap["pr_"+action],
+			action, window, limit)
+		if err != nil {
+			log.Errorf(ctx, "Error fetching %s pull requests: %v", action, err)
+			errors = fmt.Errorf("%v\nError with %s Pull Requests: %v", errors, action, err)
+		}
+	}
+	// Get Reviews and Review Comments
+	reviews := map[string][]Review{}
+	for _, kind := range []string{"review", "review_comment"} {
+		reviews[kind], err = sourceReviews(ctx, source, eventReposMap[kind], kind, window, limit)
+		if err != nil {
+			log.Errorf(ctx, "Error fetching %s: %v", kind, err)
+			errors = fmt.Errorf("%v\nError with %s: %v", errors, kind, err)
+		}
+	}
+	// Get Releases, Forks and Stars
+	releases, err := sourceReleases(ctx, source, eventReposMap["release"], window, limit)
+	if err != nil {
+		log.Errorf(ctx, "Error fetching releases: %v", err)
+		errors = fmt.Errorf("%v\nError with Releases: %v", errors, err)
+	}
+	forks, err := sourceForks(ctx, source, eventReposMap["fork"], window, limit)
+	if err != nil {
+		log.Errorf(ctx, "Error fetching forks: %v", err)
+		errors = fmt.Errorf("%v\nError with Forks: %v", errors, err)
+	}
+	stars, err := sourceStars(ctx, source, eventReposMap["star"], window)
+	if err != nil {
+		log.Errorf(ctx, "Error fetching stars: %v", err)
+		errors = fmt.Errorf("%v\nError with Stars: %v", errors, err)
+	}
+	return events{
+		Opened:    openIssues,
+		Closed:    closedIssues,
+		Reopened:  reopenedIssues,
+		Comments:  comments,
+		NoComment: repoWithNoComment,
+
+		PullsOpened:    pulls["opened"],
+		PullsMerged:    pulls["merged"],
+		PullsClosed:    pulls["closed"],
+		ReviewRequests: pulls["review_requested"],
+		Reviews:        reviews["review"],
+		ReviewComments: reviews["review_comment"],
+
+		Releases: releases,
+		Forks:    forks,
+		Stars:    stars,
+
+		Window: window,
+	}, errors
+}
+
+// makePayloads sorts the fetched data by repo and email address for subscriptions.
+// Data for repos that subscriptions don't follow for emailType is left out, so that
+// events fetched for many users can be shared.
+func makePayloads(subscriptions []Subscription, emailType Frequency,
+	fetched events) []EmailPayload {
+
+	fetched = newSubscriptionFilters(subscriptions).apply(fetched)
+	eventReposMap := mapMaker(subscriptions, emailType)
+	watched := func(kind string) repoSet {
+		return newSubscribedRepoSet(eventReposMap[kind], subscriptions)
+	}
+	openIssues := filterIssues(fetched.Opened, watched("opened"))
+	closedIssues := filterIssues(fetched.Closed, watched("closed"))
+	reopenedIssues := filterIssues(fetched.Reopened, watched("reopened"))
+	comments := filterComments(fetched.Comments, watched("comment"))
+	if emailType == Immediate {
+		comments = coalesceComments(comments)
+	}
+	repoWithNoComment := filterRepos(fetched.NoComment, watched("nocomment"))
+	openPulls := filterPulls(fetched.PullsOpened, watched("pr_opened"))
+	mergedPulls := filterPulls(fetched.PullsMerged, watched("pr_merged"))
+	closedPulls := filterPulls(fetched.PullsClosed, watched("pr_closed"))
+	reviewRequests := filterPulls(fetched.ReviewRequests, watched("pr_review_requested"))
+	reviews := append(filterReviews(fetched.Reviews, watched("review")),
+		filterReviews(fetched.ReviewComments, watched("review_comment"))...)
+
 	// Remove all closed issues from open issues
 	openIssues = issueDiff(openIssues, closedIssues)
 	// Add all reopen to open if reopen date is greater than closed date for common issues
@@ -88,20 +262,18 @@ func FetchData(c context.Context,
 	for _, issue := range reopenedIssues {
 		openIssues = append(openIssues, issue)
 	}
-	// Get list of repos with no comment
-	repoWithNoComment := []string{}
-	for _, repo := range eventReposMap["nocomment"] {
-		if add, err := checkNoComment(ctx, repo, emailType); add && err == nil {
-			repoWithNoComment = append(repoWithNoComment, repo)
-		}
-	}
-	log.Infof(ctx, "No Comments on: %v", repoWithNoComment)
-	if len(openIssues)+len(closedIssues)+len(comments)+len(repoWithNoComment) == 0 {
+	releases := filterReleases(fetched.Releases, watched("release"))
+	forks := filterForks(fetched.Forks, watched("fork"))
+	stars := filterStars(fetched.Stars, watched("star"))
+
+	pullCount := len(openPulls) + len(mergedPulls) + len(closedPulls) + len(reviewRequests)
+	repoCount := len(releases) + len(forks) + len(stars)
+	if len(openIssues)+len(closedIssues)+len(comments)+len(repoWithNoComment)+
+		pullCount+len(reviews)+repoCount == 0 {
 		// No data to send emails
 		log.Infof(ctx, "No emails sent for user: %v", subscriptions[0].UserID)
-		return nil, nil
+		return nil
 	}
-
 	//  Sort all fetched data by repo:
 	repoData := make(map[string]Payload)
 
@@ -131,14 +303,71 @@ func FetchData(c context.Context,
 		value := repoData[repo]
 		value.RepoName = repo
 		value.NoComment = true
-		value.NoCommentSince = getCommentCheckTime(emailType)
+		value.NoCommentSince = fetched.Window.Start
 		repoData[repo] = value
 	}
 
+	for _, pulls := range [][]PullRequest{openPulls, mergedPulls, closedPulls, reviewRequests} {
+		for _, pull := range pulls {
+			key := repoFromURL(pull.Repo)
+			value := repoData[key]
+			value.RepoName = key
+			switch {
+			case pull.Action == "merged":
+				value.MergedPulls = append(value.MergedPulls, pull)
+			case pull.Action == "closed":
+				value.ClosedPulls = append(value.ClosedPulls, pull)
+			case pull.Action == "review_requested":
+				value.ReviewRequests = append(value.ReviewRequests, pull)
+			default:
+				value.OpenPulls = append(value.OpenPulls, pull)
+			}
+			repoData[key] = value
+		}
+	}
+	for _, review := range reviews {
+		key := repoFromURL(review.Repo)
+		value := repoData[key]
+		value.RepoName = key
+		value.Reviews = append(value.Reviews, review)
+		repoData[key] = value
+	}
+
+	for _, release := range releases {
+		key := repoFromURL(release.Repo)
+		value := repoData[key]
+		value.RepoName = key
+		value.Releases = append(value.Releases, release)
+		repoData[key] = value
+	}
+	for _, fork := range forks {
+		key := repoFromURL(fork.Repo)
+		value := repoData[key]
+		value.RepoName = key
+		value.Forks = append(value.Forks, fork)
+		repoData[key] = value
+	}
+	for key, count := range stars {
+		value := repoData[key]
+		value.RepoName = key
+		value.NewStars = count
+		repoData[key] = value
+	}
+
 	//Sort all subscriptions by email
 	emailRepoMap := make(map[string][]string)
+	emailSubMap := make(map[string][]uint)
 	for _, sub := range subscriptions {
-		emailRepoMap[sub.DefaultEmail] = append(emailRepoMap[sub.DefaultEmail], sub.Repo)
+		emailSubMap[sub.DefaultEmail] = append(emailSubMap[sub.DefaultEmail], sub.ID)
+		if IsRepoPattern(sub.Repo) {
+			// Patterns include every repo that matches them and has activity
+			emailRepoMap[sub.DefaultEmail] = append(emailRepoMap[sub.DefaultEmail],
+				matchingRepos(repoData, sub.Repo, emailRepoMap[sub.DefaultEmail])...)
+			continue
+		}
+		if !listToSet(emailRepoMap[sub.DefaultEmail])[sub.Repo] {
+			emailRepoMap[sub.DefaultEmail] = append(emailRepoMap[sub.DefaultEmail], sub.Repo)
+		}
 		data := repoData[sub.Repo]
 		repoData[sub.Repo] = data
 	}
@@ -147,12 +376,14 @@ func FetchData(c context.Context,
 	results := []EmailPayload{}
 	for id, repos := range emailRepoMap {
 		payload := EmailPayload{
-			Email:   id,
-			Content: getPayloads(repoData, repos...),
+			Email:         id,
+			Content:       getPayloads(repoData, repos...),
+			Window:        fetched.Window,
+			Subscriptions: emailSubMap[id],
 		}
 		results = append(results, payload)
 	}
-	return results, errors
+	return results
 }
 
 // mapMaker returns a map with repo names sorted according to Github Event types
@@ -163,81 +394,132 @@ func mapMaker(subscriptions []Subscription, emailType Frequency) eventRepo {
 	repos := make(eventRepo)
 	for _, sub := range subscriptions {
 		if sub.EmailPreference.IssueOpen == emailType {
-			repos["opened"] = append(repos["opened"], sub.Repo)
+			repos.add("opened", sub.Repo)
 		}
 		if sub.EmailPreference.IssueClose == emailType {
-			repos["closed"] = append(repos["closed"], sub.Repo)
+			repos.add("closed", sub.Repo)
 		}
 		if sub.EmailPreference.IssueReopen == emailType {
-			repos["reopened"] = append(repos["reopened"], sub.Repo)
+			repos.add("reopened", sub.Repo)
 		}
 		if sub.EmailPreference.NewComment == emailType {
-			repos["comment"] = append(repos["comment"], sub.Repo)
+			repos.add("comment", sub.Repo)
+		}
+		// Frequent digests are for activity, not for the lack of it
+		if sub.EmailPreference.NoComment == emailType && !emailType.Frequent() {
+			repos.add("nocomment", sub.Repo)
 		}
-		if sub.EmailPreference.NoComment == emailType {
-			repos["nocomment"] = append(repos["nocomment"], sub.Repo)
+		if sub.EmailPreference.PullOpen == emailType {
+			repos.add("pr_opened", sub.Repo)
+		}
+		if sub.EmailPreference.PullMerge == emailType {
+			repos.add("pr_merged", sub.Repo)
+		}
+		if sub.EmailPreference.PullClose == emailType {
+			repos.add("pr_closed", sub.Repo)
+		}
+		if sub.EmailPreference.PullReviewRequest == emailType {
+			repos.add("pr_review_requested", sub.Repo)
+		}
+		if sub.EmailPreference.PullReview == emailType {
+			repos.add("review", sub.Repo)
+		}
+		if sub.EmailPreference.PullReviewComment == emailType {
+			repos.add("review_comment", sub.Repo)
+		}
+		if sub.EmailPreference.Release == emailType {
+			repos.add("release", sub.Repo)
+		}
+		if sub.EmailPreference.Star == emailType {
+			repos.add("star", sub.Repo)
+		}
+		if sub.EmailPreference.Fork == emailType {
+			repos.add("fork", sub.Repo)
 		}
 	}
 	log.Infof(ctx, "mapMaker: %v", repos)
 	return repos
 }
 
-func optionMaker(m map[string][]string, emailType Frequency) eventOptions {
+// sourceIssues gets issues from source unless there are no repos to get them for
+func sourceIssues(ctx context.Context, source EventSource,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
 
-	options := make(eventOptions)
+	if len(repos) == 0 {
+		return []Issue{}, nil
+	}
+	return source.Issues(ctx, repos, action, w, limit)
+}
 
-	for event, repos := range m {
-		if isIssueEvent(event) {
-			o := Options{
-				Repositories: repos,
-				Conditions: []string{
-					bq.In("type", "IssuesEvent"),
-					bq.In("repo.name", repos...),
-					bq.In(bq.JExtract("payload", "action"), event),
-				},
-			}
-			o.SetTables(emailType)
-			options[event] = o
-		}
-		if event == "comment" {
-			o := Options{
-				Repositories: repos,
-				Conditions: []string{
-					bq.In("type", "IssueCommentEvent"),
-					bq.In("repo.name", repos...),
-					bq.In(bq.JExtract("payload", "issue.state"), "open"),
-					bq.In(bq.JExtract("payload", "action"), "created"),
-				},
-			}
-			o.SetTables(emailType)
-			options[event] = o
-		}
+// sourceComments gets comments from source unless there are no repos to get them for
+func sourceComments(ctx context.Context, source EventSource,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+
+	if len(repos) == 0 {
+		return []Comment{}, nil
 	}
-	log.Infof(ctx, "optionMaker: %v", options)
-	return options
+	return source.Comments(ctx, repos, w, limit)
 }
 
-func isIssueEvent(e string) bool {
-	issueEvent := map[string]bool{
-		"opened":   true,
-		"closed":   true,
-		"reopened": true,
+// sourcePullRequests gets pull requests from source unless there are no repos to get them for
+func sourcePullRequests(ctx context.Context, source EventSource,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+
+	if len(repos) == 0 {
+		return []PullRequest{}, nil
 	}
-	if issueEvent[e] {
-		return true
+	return source.PullRequests(ctx, repos, action, w, limit)
+}
+
+// sourceReviews gets reviews from source unless there are no repos to get them for
+func sourceReviews(ctx context.Context, source EventSource,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+
+	if len(repos) == 0 {
+		return []Review{}, nil
 	}
-	return false
+	return source.Reviews(ctx, repos, kind, w, limit)
 }
 
-// Retrieves issues from BigQuery
-func fetchIssues(ctx context.Context, m eventOptions, event string) ([]Issue, error) {
+// sourceReleases gets releases from source unless there are no repos to get them for
+func sourceReleases(ctx context.Context, source EventSource,
+	repos []string, w Window, limit uint64) ([]Release, error) {
 
-	fetcher := IssueFetcher{
-		Opts: m[event],
+	if len(repos) == 0 {
+		return []Release{}, nil
+	}
+	return source.Releases(ctx, repos, w, limit)
+}
+
+// sourceForks gets forks from source unless there are no repos to get them for
+func sourceForks(ctx context.Context, source EventSource,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+
+	if len(repos) == 0 {
+		return []Fork{}, nil
 	}
-	if len(fetcher.Opts.Repositories) == 0 {
+	return source.Forks(ctx, repos, w, limit)
+}
+
+// sourceStars gets the number of stars from source unless there are no repos to get them for
+func sourceStars(ctx context.Context, source EventSource,
+	repos []string, w Window) (map[string]int, error) {
+
+	if len(repos) == 0 {
+		return map[string]int{}, nil
+	}
+	return source.Stars(ctx, repos, w)
+}
+
+// Retrieves issues from BigQuery
+func fetchIssues(ctx context.Context, o Options) ([]Issue, error) {
+
+	if len(o.Repositories) == 0 {
 		return []Issue{}, nil
 	}
+	fetcher := IssueFetcher{
+		Opts: o,
+	}
 	results, err := fetcher.Fetch(ctx)
 	if err != nil {
 		log.Errorf(ctx, "Issue Fetch: %v", err)
@@ -247,7 +529,7 @@ func fetchIssues(ctx context.Context, m eventOptions, event string) ([]Issue, er
 	return results, nil
 }
 
-// Retrieves issues from BigQuery
+// Retrieves comments from BigQuery
 func fetchComments(ctx context.Context, o Options) ([]Comment, error) {
 
 	if len(o.Repositories) == 0 {
@@ -265,15 +547,173 @@ func fetchComments(ctx context.Context, o Options) ([]Comment, error) {
 	return results, nil
 }
 
+// Retrieves pull requests from BigQuery
+func fetchPullRequests(ctx context.Context, o Options) ([]PullRequest, error) {
+
+	if len(o.Repositories) == 0 {
+		return []PullRequest{}, nil
+	}
+	fetcher := PullRequestFetcher{
+		Opts: o,
+	}
+	results, err := fetcher.Fetch(ctx)
+	if err != nil {
+		log.Errorf(ctx, "Pull Request Fetch: %v", err)
+		return nil, err
+	}
+	log.Infof(ctx, "fetchPullRequests: %v", len(results))
+	return results, nil
+}
+
+// Retrieves reviews or review comments from BigQuery
+func fetchReviews(ctx context.Context, o Options) ([]Review, error) {
+
+	if len(o.Repositories) == 0 {
+		return []Review{}, nil
+	}
+	fetcher := ReviewFetcher{
+		Opts: o,
+	}
+	results, err := fetcher.Fetch(ctx)
+	if err != nil {
+		log.Errorf(ctx, "Review Fetch: %v", err)
+		return nil, err
+	}
+	log.Infof(ctx, "fetchReviews: %v", len(results))
+	return results, nil
+}
+
 func repoFromIssue(i Issue) string {
-	path := strings.SplitAfterN(i.Repo, "/", 5)
-	return path[len(path)-1]
+	return repoFromURL(i.Repo)
 }
 func repoFromComment(c Comment) string {
-	path := strings.SplitAfterN(c.Repo, "/", 5)
+	return repoFromURL(c.Repo)
+}
+
+// repoFromURL returns the name of a repo from its API url
+func repoFromURL(url string) string {
+	path := strings.SplitAfterN(url, "/", 5)
 	return path[len(path)-1]
 }
 
+// filterIssues returns issues from repos, up to the default limit of results for a query
+func filterIssues(issues []Issue, watched repoSet) []Issue {
+	result := []Issue{}
+	for _, x := range issues {
+		if watched.has(repoFromIssue(x)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// filterComments returns comments from repos, up to the default limit of results for a query
+func filterComments(comments []Comment, watched repoSet) []Comment {
+	result := []Comment{}
+	for _, x := range comments {
+		if watched.has(repoFromComment(x)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// coalesceComments keeps the latest comment on each issue, counting the others in More,
+// so that a burst of comments on one issue results in one entry
+func coalesceComments(comments []Comment) []Comment {
+	latest := map[string]int{} // index in result of the comment kept for an issue
+	result := []Comment{}
+	for _, x := range comments {
+		key := x.Repo + "#" + x.IssueID
+		i, ok := latest[key]
+		if !ok {
+			latest[key] = len(result)
+			result = append(result, x)
+			continue
+		}
+		more := result[i].More + 1
+		if x.Created.After(result[i].Created) {
+			result[i] = x
+		}
+		result[i].More = more
+	}
+	return result
+}
+
+// filterPulls returns pull requests from repos, up to the default limit of results for a query
+func filterPulls(pulls []PullRequest, watched repoSet) []PullRequest {
+	result := []PullRequest{}
+	for _, x := range pulls {
+		if watched.has(repoFromURL(x.Repo)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// filterReviews returns reviews from repos, up to the default limit of results for a query
+func filterReviews(reviews []Review, watched repoSet) []Review {
+	result := []Review{}
+	for _, x := range reviews {
+		if watched.has(repoFromURL(x.Repo)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// filterReleases returns releases from repos, up to the default limit of results for a query
+func filterReleases(releases []Release, watched repoSet) []Release {
+	result := []Release{}
+	for _, x := range releases {
+		if watched.has(repoFromURL(x.Repo)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// filterForks returns forks from repos, up to the default limit of results for a query
+func filterForks(forks []Fork, watched repoSet) []Fork {
+	result := []Fork{}
+	for _, x := range forks {
+		if watched.has(repoFromURL(x.Repo)) && uint64(len(result)) < defaultLimit {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// filterStars returns the number of stars for repos that were starred
+func filterStars(stars map[string]int, watched repoSet) map[string]int {
+	result := map[string]int{}
+	for repo, count := range stars {
+		if watched.has(repo) && count > 0 {
+			result[repo] = count
+		}
+	}
+	return result
+}
+
+// filterRepos returns the repos in A that are also in mb
+func filterRepos(A []string, mb repoSet) []string {
+	result := []string{}
+	for _, x := range A {
+		if mb.has(x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+func listToSet(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, x := range list {
+		set[x] = true
+	}
+	return set
+}
+
 // issueDiff is a helper method to remove B from A
 func issueDiff(A []Issue, B []Issue) []Issue {
 	mb := map[int64]bool{}
@@ -305,6 +745,20 @@ func validateReopen(reopen []Issue, closed []Issue) []Issue {
 }
 
 // returns payload for given repos
+// matchingRepos returns the sorted names of repos in m that match pattern, leaving out
+// the ones that are already listed
+func matchingRepos(m map[string]Payload, pattern string, listed []string) []string {
+	skip := listToSet(listed)
+	results := []string{}
+	for repo := range m {
+		if matchRepo(pattern, repo) && !skip[repo] {
+			results = append(results, repo)
+		}
+	}
+	sort.Strings(results)
+	return results
+}
+
 func getPayloads(m map[string]Payload, repos ...string) []Payload {
 	results := []Payload{}
 	for _, repo := range repos {
@@ -21,6 +21,8 @@ import (
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/internal/testutil"
 
+	"golang.org/x/net/context"
+
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/aetest"
 )
@@ -41,25 +43,24 @@ func TestFetchers(t *testing.T) {
 
 	req, err := inst.NewRequest("GET", "/", nil)
 	ctx := appengine.NewContext(req)
-	m := make(eventOptions)
-	m["opened"] = Options{
-		Tables:       []string{"ghissues.test_bed"},
+	m := Options{
+		Tables:       []bq.Table{{Name: "ghissues.test_bed"}},
 		Repositories: []string{"GoogleCloudPlatform/google-cloud-node"},
-		Conditions: []string{
+		Conditions: []bq.Condition{
 			bq.In("type", "IssuesEvent"),
 			bq.In("repo_name", "GoogleCloudPlatform/google-cloud-node"),
 			bq.In(bq.JExtract("payload", "action"), "opened"),
 		},
 		Limit: 1,
 	}
-	issues, err := fetchIssues(ctx, m, "opened")
+	issues, err := fetchIssues(ctx, m)
 	if err != nil || len(issues) != 1 {
 		t.Errorf("IssueFetcher() failed got %v with error: %v", issues, err)
 	}
 	o := Options{
-		Tables:       []string{"ghissues.test_bed"},
+		Tables:       []bq.Table{{Name: "ghissues.test_bed"}},
 		Repositories: []string{"GoogleCloudPlatform/google-cloud-node"},
-		Conditions: []string{
+		Conditions: []bq.Condition{
 			bq.In("type", "IssueCommentEvent"),
 			bq.In("repo_name", "GoogleCloudPlatform/google-cloud-node"),
 			bq.In(bq.JExtract("payload", "action"), "created"),
@@ -125,8 +126,226 @@ func TestFetchData(t *testing.T) {
 			},
 		},
 	}
-	_, err = FetchData(ctx, subs, Weekly)
+	_, err = FetchData(ctx, BigQuerySource{}, subs, Weekly)
 	if err != nil {
 		t.Errorf("Errors while Fetching Data: %v", err)
 	}
 }
+
+// fakeSource is an EventSource that returns fixed results
+type fakeSource struct {
+	issues   map[string][]Issue
+	comments []Comment
+	pulls    map[string][]PullRequest
+	reviews  map[string][]Review
+	stars    map[string]int
+}
+
+func (s fakeSource) Issues(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
+	return s.issues[action], nil
+}
+
+func (s fakeSource) Comments(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+	return s.comments, nil
+}
+
+func (s fakeSource) PullRequests(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+	return s.pulls[action], nil
+}
+
+func (s fakeSource) Reviews(ctx context.Context,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+	return s.reviews[kind], nil
+}
+
+func (s fakeSource) Releases(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Release, error) {
+	return nil, nil
+}
+
+func (s fakeSource) Forks(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+	return nil, nil
+}
+
+func (s fakeSource) Stars(ctx context.Context,
+	repos []string, w Window) (map[string]int, error) {
+	return s.stars, nil
+}
+
+// TestFetchDataSource tests FetchData with an EventSource that doesn't need BigQuery
+func TestFetchDataSource(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("Failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	req, err := inst.NewRequest("GET", "/daily", nil)
+	ctx := appengine.NewContext(req)
+	repo := "https://api.github.com/repos/GoogleCloudPlatform/java-docs-samples"
+	source := fakeSource{
+		issues: map[string][]Issue{
+			"opened": {{ID: 1, Repo: repo}, {ID: 2, Repo: repo}},
+			"closed": {{ID: 2, Repo: repo}, {ID: 3, Repo: "https://api.github.com/repos/other/repo"}},
+		},
+		comments: []Comment{{ID: 4, Repo: repo}},
+		pulls: map[string][]PullRequest{
+			"merged": {{ID: 5, Repo: repo, Action: "merged", Actor: "merger"}},
+		},
+		reviews: map[string][]Review{
+			"review": {{ID: 6, Repo: repo, State: "approved"}},
+		},
+		stars: map[string]int{"GoogleCloudPlatform/java-docs-samples": 3},
+	}
+	subs := []Subscription{
+		Subscription{
+			DefaultEmail: "default@go.co",
+			Repo:         "GoogleCloudPlatform/java-docs-samples",
+			EmailPreference: EmailPreference{
+				IssueOpen:   Daily,
+				IssueClose:  Daily,
+				IssueReopen: Never,
+				NoComment:   Never,
+				NewComment:  Daily,
+				PullMerge:   Daily,
+				PullReview:  Daily,
+				Star:        Daily,
+			},
+		},
+	}
+	results, err := FetchData(ctx, source, subs, Daily)
+	if err != nil {
+		t.Fatalf("Errors while Fetching Data: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Content) != 1 {
+		t.Fatalf("FetchData() got %v, wanted one email for one repo", results)
+	}
+	got := results[0].Content[0]
+	if len(got.OpenIssues) != 1 || got.OpenIssues[0].ID != 1 {
+		t.Errorf("FetchData() got open issues %v, wanted issue 1", got.OpenIssues)
+	}
+	if len(got.ClosedIssues) != 1 || got.ClosedIssues[0].ID != 2 {
+		t.Errorf("FetchData() got closed issues %v, wanted issue 2", got.ClosedIssues)
+	}
+	if len(got.Comments) != 1 {
+		t.Errorf("FetchData() got comments %v, wanted 1 comment", got.Comments)
+	}
+	if len(got.MergedPulls) != 1 || got.MergedPulls[0].Actor != "merger" {
+		t.Errorf("FetchData() got merged pull requests %v, wanted 1", got.MergedPulls)
+	}
+	if len(got.Reviews) != 1 {
+		t.Errorf("FetchData() got reviews %v, wanted 1 review", got.Reviews)
+	}
+	if got.NewStars != 3 {
+		t.Errorf("FetchData() got %v new stars, wanted 3", got.NewStars)
+	}
+}
+
+func TestCoalesceComments(t *testing.T) {
+	now := time.Now()
+	comments := []Comment{
+		{ID: 1, IssueID: "10", Repo: "a/b", Created: now.Add(-3 * time.Minute)},
+		{ID: 2, IssueID: "10", Repo: "a/b", Created: now.Add(-1 * time.Minute)},
+		{ID: 3, IssueID: "11", Repo: "a/b", Created: now.Add(-2 * time.Minute)},
+		{ID: 4, IssueID: "10", Repo: "a/c", Created: now.Add(-2 * time.Minute)},
+		{ID: 5, IssueID: "10", Repo: "a/b", Created: now.Add(-2 * time.Minute)},
+	}
+	got := coalesceComments(comments)
+	want := map[int64]int{2: 2, 3: 0, 4: 0}
+	if len(got) != len(want) {
+		t.Fatalf("coalesceComments() got %v, wanted %d comments", got, len(want))
+	}
+	for _, c := range got {
+		if more, ok := want[c.ID]; !ok || c.More != more {
+			t.Errorf("coalesceComments() got comment %d with %d more, wanted %v", c.ID, c.More, want)
+		}
+	}
+}
+
+func TestImmediateWindow(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2017, 8, 10, 10, 7, 30, 0, usLoc)
+	w := NewWindow(Immediate, at)
+	start := time.Date(2017, 8, 10, 10, 0, 0, 0, usLoc)
+	end := time.Date(2017, 8, 10, 10, 5, 0, 0, usLoc)
+	if !w.Start.Equal(start) || !w.End.Equal(end) {
+		t.Errorf("NewWindow(Immediate) got %v, wanted %v to %v", w, start, end)
+	}
+	if next := NewWindow(Immediate, at.Add(ImmediateInterval)); !next.Start.Equal(w.End) {
+		t.Errorf("NewWindow(Immediate) got %v after %v, wanted no gap", next, w)
+	}
+}
+
+// TestCalendarWindow checks that daily, weekly and monthly windows are calendar periods
+func TestCalendarWindow(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2017, 8, 10, 23, 0, 0, 0, usLoc)
+	testcases := []struct {
+		f          Frequency
+		start, end time.Time
+	}{
+		{Daily, time.Date(2017, 8, 10, 0, 0, 0, 0, usLoc), time.Date(2017, 8, 11, 0, 0, 0, 0, usLoc)},
+		{Weekly, time.Date(2017, 8, 4, 0, 0, 0, 0, usLoc), time.Date(2017, 8, 11, 0, 0, 0, 0, usLoc)},
+		{Monthly, time.Date(2017, 8, 1, 0, 0, 0, 0, usLoc), time.Date(2017, 9, 1, 0, 0, 0, 0, usLoc)},
+	}
+	for _, tc := range testcases {
+		w := NewWindow(tc.f, at)
+		if !w.Start.Equal(tc.start) || !w.End.Equal(tc.end) {
+			t.Errorf("NewWindow(%d) got %v, wanted %v to %v", tc.f, w, tc.start, tc.end)
+		}
+	}
+	// Windows are in Pacific time whatever the time zone of t
+	if w := NewWindow(Daily, at.UTC()); !w.Start.Equal(testcases[0].start) {
+		t.Errorf("NewWindow(Daily) in UTC got %v, wanted %v", w, testcases[0].start)
+	}
+}
+
+// TestImmediateLag checks that immediate windows lag behind the sources that are loaded late
+func TestImmediateLag(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2017, 8, 10, 10, 7, 30, 0, usLoc)
+	lagged := NewWindow(Immediate, at.Add(-archiveLag))
+	testcases := []struct {
+		source EventSource
+		sub    Subscription
+		want   Window
+	}{
+		{StoreSource{}, Subscription{Repo: "a/b"}, NewWindow(Immediate, at)},
+		{BigQuerySource{}, Subscription{Repo: "a/b"}, lagged},
+		{APISource{}, Subscription{Repo: "a/b", Source: SourceBigQuery}, lagged},
+	}
+	for _, tc := range testcases {
+		w := DigestWindow(tc.source, []Subscription{tc.sub}, Immediate, at)
+		if !w.Start.Equal(tc.want.Start) || !w.End.Equal(tc.want.End) {
+			t.Errorf("DigestWindow(Immediate) from %T for %v got %v, wanted %v", tc.source,
+				tc.sub.Source, w, tc.want)
+		}
+	}
+}
+
+func TestLoadedWindow(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2017, 8, 10, 10, 0, 0, 0, usLoc)
+	w := NewWindow(Daily, at)
+	testcases := []struct {
+		source EventSource
+		want   time.Time
+	}{
+		{StoreSource{}, w.End},
+		{BigQuerySource{}, w.End.Add(-archiveLag)},
+	}
+	for _, tc := range testcases {
+		got := w.Loaded(tc.source, []Subscription{{Repo: "a/b"}})
+		if !got.Start.Equal(w.Start) || !got.End.Equal(tc.want) {
+			t.Errorf("Loaded from %T got %v, wanted it to end at %v", tc.source, got, tc.want)
+		}
+	}
+	// Windows ending before they start are empty
+	if got := w.until(w.Start.Add(-time.Hour)); !got.Start.Equal(got.End) {
+		t.Errorf("until got %v, which starts after it ends", got)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strings"
+)
+
+// Filter stores rules that limit the activity of a subscription that is sent in digests.
+// Empty lists don't filter anything.
+//
+// Label rules apply to issues. Author and bot rules apply to issues, comments, pull
+// requests, reviews, releases and forks. Keyword rules apply to the title and body of
+// issues, the title of pull requests and the body of comments and reviews.
+type Filter struct {
+	SubscriptionID  uint  `gorm:"unique;index;not null;"`
+	IncludeLabels   Names `gorm:"type:TEXT;"` // only issues with one of the labels
+	ExcludeLabels   Names `gorm:"type:TEXT;"` // no issues with any of the labels
+	IncludeAuthors  Names `gorm:"type:TEXT;"` // only activity by one of the github logins
+	ExcludeAuthors  Names `gorm:"type:TEXT;"` // no activity by any of the github logins
+	IncludeKeywords Names `gorm:"type:TEXT;"` // only activity with one of the keywords
+	ExcludeKeywords Names `gorm:"type:TEXT;"` // no activity with any of the keywords
+	ExcludeBots     bool  // no activity by bots such as dependabot[bot] or k8s-ci-robot
+}
+
+// botSuffixes are the endings of github logins used by bots
+var botSuffixes = []string{"[bot]", "-bot", "-robot"}
+
+// isBot reports whether login looks like the login of a bot
+func isBot(login string) bool {
+	login = strings.ToLower(login)
+	for _, suffix := range botSuffixes {
+		if strings.HasSuffix(login, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty reports whether f has no rules
+func (f Filter) IsEmpty() bool {
+	return len(f.IncludeLabels)+len(f.ExcludeLabels)+len(f.IncludeAuthors)+
+		len(f.ExcludeAuthors)+len(f.IncludeKeywords)+len(f.ExcludeKeywords) == 0 &&
+		!f.ExcludeBots
+}
+
+// matchAuthor reports whether activity by author passes the author and bot rules of f
+func (f Filter) matchAuthor(author string) bool {
+	if f.ExcludeBots && isBot(author) {
+		return false
+	}
+	if len(f.IncludeAuthors) != 0 && !containsFold(f.IncludeAuthors, author) {
+		return false
+	}
+	return !containsFold(f.ExcludeAuthors, author)
+}
+
+// matchLabels reports whether an issue with labels passes the label rules of f
+func (f Filter) matchLabels(labels Names) bool {
+	if len(f.IncludeLabels) != 0 && !anyFold(f.IncludeLabels, labels) {
+		return false
+	}
+	return !anyFold(f.ExcludeLabels, labels)
+}
+
+// matchText reports whether activity with texts, such as its title and body, passes the
+// keyword rules of f. Keywords match case insensitive substrings.
+func (f Filter) matchText(texts ...string) bool {
+	text := strings.ToLower(strings.Join(texts, "\n"))
+	if len(f.IncludeKeywords) != 0 && !containsKeyword(text, f.IncludeKeywords) {
+		return false
+	}
+	return !containsKeyword(text, f.ExcludeKeywords)
+}
+
+// containsFold reports whether names has s, ignoring case
+func containsFold(names Names, s string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyFold reports whether names has one of values, ignoring case
+func anyFold(names Names, values Names) bool {
+	for _, v := range values {
+		if containsFold(names, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsKeyword reports whether the lower case text contains one of keywords
+func containsKeyword(text string, keywords Names) bool {
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); len(k) != 0 && strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionFilters holds the filter of each subscription by repo name or pattern
+type subscriptionFilters struct {
+	subscriptions []Subscription
+	filters       map[string]Filter
+}
+
+// newSubscriptionFilters returns the filters of subscriptions, including empty filters so
+// that a subscription for a repo takes precedence over the patterns that match it
+func newSubscriptionFilters(subscriptions []Subscription) subscriptionFilters {
+	filters := map[string]Filter{}
+	for _, sub := range subscriptions {
+		filters[sub.Repo] = sub.Filter
+	}
+	return subscriptionFilters{subscriptions: subscriptions, filters: filters}
+}
+
+// isEmpty reports whether none of the filters have rules
+func (s subscriptionFilters) isEmpty() bool {
+	for _, f := range s.filters {
+		if !f.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns the filter of the subscription for repo, or of the first subscribed
+// pattern that repo matches in the order of the subscriptions
+func (s subscriptionFilters) filter(repo string) Filter {
+	if name, ok := SubscribedRepo(s.subscriptions, repo); ok {
+		return s.filters[name]
+	}
+	return Filter{}
+}
+
+// issues returns the issues that pass the filter of their repo
+func (s subscriptionFilters) issues(issues []Issue) []Issue {
+	result := []Issue{}
+	for _, x := range issues {
+		f := s.filter(repoFromURL(x.Repo))
+		if f.matchAuthor(x.Author) && f.matchLabels(x.Labels) && f.matchText(x.Title, x.Body) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// comments returns the comments that pass the filter of their repo
+func (s subscriptionFilters) comments(comments []Comment) []Comment {
+	result := []Comment{}
+	for _, x := range comments {
+		f := s.filter(repoFromURL(x.Repo))
+		if f.matchAuthor(x.Author) && f.matchText(x.Body) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// pulls returns the pull requests that pass the filter of their repo
+func (s subscriptionFilters) pulls(pulls []PullRequest) []PullRequest {
+	result := []PullRequest{}
+	for _, x := range pulls {
+		f := s.filter(repoFromURL(x.Repo))
+		if f.matchAuthor(x.Author) && f.matchText(x.Title) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// reviews returns the reviews that pass the filter of their repo
+func (s subscriptionFilters) reviews(reviews []Review) []Review {
+	result := []Review{}
+	for _, x := range reviews {
+		f := s.filter(repoFromURL(x.Repo))
+		if f.matchAuthor(x.Author) && f.matchText(x.PullTitle, x.Body) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// releases returns the releases that pass the author rules of the filter of their repo
+func (s subscriptionFilters) releases(releases []Release) []Release {
+	result := []Release{}
+	for _, x := range releases {
+		if s.filter(repoFromURL(x.Repo)).matchAuthor(x.Author) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// forks returns the forks that pass the author rules of the filter of their repo
+func (s subscriptionFilters) forks(forks []Fork) []Fork {
+	result := []Fork{}
+	for _, x := range forks {
+		if s.filter(repoFromURL(x.Repo)).matchAuthor(x.Owner) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// apply returns the events that pass the filters. Events are fetched once for all
+// subscribers of a repo, so filters are applied to the shared events for every user
+// instead of being added to the conditions of the queries.
+func (s subscriptionFilters) apply(fetched events) events {
+	if s.isEmpty() {
+		return fetched
+	}
+	fetched.Opened = s.issues(fetched.Opened)
+	fetched.Closed = s.issues(fetched.Closed)
+	fetched.Reopened = s.issues(fetched.Reopened)
+	fetched.Comments = s.comments(fetched.Comments)
+	fetched.PullsOpened = s.pulls(fetched.PullsOpened)
+	fetched.PullsMerged = s.pulls(fetched.PullsMerged)
+	fetched.PullsClosed = s.pulls(fetched.PullsClosed)
+	fetched.ReviewRequests = s.pulls(fetched.ReviewRequests)
+	fetched.Reviews = s.reviews(fetched.Reviews)
+	fetched.ReviewComments = s.reviews(fetched.ReviewComments)
+	fetched.Releases = s.releases(fetched.Releases)
+	fetched.Forks = s.forks(fetched.Forks)
+	return fetched
+}
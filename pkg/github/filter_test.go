@@ -0,0 +1,96 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+)
+
+// TestFilterIssues checks that the filter of a subscription only applies to its repo
+func TestFilterIssues(t *testing.T) {
+	const (
+		repo  = "https://api.github.com/repos/kubernetes/kubernetes"
+		other = "https://api.github.com/repos/GoogleCloudPlatform/google-cloud-go"
+	)
+	issues := []Issue{
+		{ID: 1, Repo: repo, Author: "alice", Title: "Scheduler panics", Labels: Names{"P0"}},
+		{ID: 2, Repo: repo, Author: "k8s-ci-robot", Title: "Flaky test", Labels: Names{"P0"}},
+		{ID: 3, Repo: repo, Author: "bob", Title: "Docs typo", Labels: Names{"docs"}},
+		{ID: 4, Repo: repo, Author: "carol", Title: "Crash", Body: "WIP", Labels: Names{"p0"}},
+		{ID: 5, Repo: other, Author: "dependabot[bot]", Title: "Bump deps"},
+	}
+	testcases := []struct {
+		name   string
+		filter Filter
+		want   []int64
+	}{
+		{"no rules", Filter{}, []int64{1, 2, 3, 4, 5}},
+		{"include labels", Filter{IncludeLabels: Names{"P0"}}, []int64{1, 2, 4, 5}},
+		{"exclude labels", Filter{ExcludeLabels: Names{"docs"}}, []int64{1, 2, 4, 5}},
+		{"include authors", Filter{IncludeAuthors: Names{"Bob"}}, []int64{3, 5}},
+		{"exclude authors", Filter{ExcludeAuthors: Names{"alice", "bob"}}, []int64{2, 4, 5}},
+		{"exclude bots", Filter{ExcludeBots: true}, []int64{1, 3, 4, 5}},
+		{"include keywords", Filter{IncludeKeywords: Names{"panic", "crash"}}, []int64{1, 4, 5}},
+		{"exclude keywords", Filter{ExcludeKeywords: Names{"wip"}}, []int64{1, 2, 3, 5}},
+	}
+	for _, tc := range testcases {
+		filters := newSubscriptionFilters([]Subscription{
+			{Repo: "kubernetes/kubernetes", Filter: tc.filter},
+			{Repo: "GoogleCloudPlatform/google-cloud-go"},
+		})
+		got := filters.apply(events{Opened: issues}).Opened
+		var ids []int64
+		for _, issue := range got {
+			ids = append(ids, issue.ID)
+		}
+		if len(ids) != len(tc.want) {
+			t.Errorf("%s: apply() got issues %v, want %v", tc.name, ids, tc.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tc.want[i] {
+				t.Errorf("%s: apply() got issues %v, want %v", tc.name, ids, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// TestFetchLimit checks that more activity is fetched for subscriptions with filters
+func TestFetchLimit(t *testing.T) {
+	plain := Subscription{Repo: "golang/go"}
+	filtered := Subscription{Repo: "kubernetes/*", Filter: Filter{ExcludeBots: true}}
+	if got := fetchLimit([]Subscription{plain}); got != 0 {
+		t.Errorf("fetchLimit() without filters = %d, want 0", got)
+	}
+	if got := fetchLimit([]Subscription{plain, filtered}); got != filteredLimit {
+		t.Errorf("fetchLimit() with filters = %d, want %d", got, filteredLimit)
+	}
+}
+
+// TestFilterPatternOrder checks that the first subscribed pattern that a repo matches
+// gives its filter
+func TestFilterPatternOrder(t *testing.T) {
+	bots := Filter{ExcludeBots: true}
+	for i := 0; i < 10; i++ {
+		filters := newSubscriptionFilters([]Subscription{
+			{Repo: "kubernetes/test-*", Filter: bots},
+			{Repo: "kubernetes/*"},
+		})
+		if got := filters.filter("kubernetes/test-infra"); !got.ExcludeBots {
+			t.Fatalf("filter() = %v, want the filter of the first pattern %v", got, bots)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// importWorkers is the number of repos that Import updates from GitHub at the same time
+const importWorkers = 4
+
+// importReserve is the number of GitHub API requests that Import leaves for other uses
+const importReserve = 100
+
+// ImportCandidate is a repo that a user can subscribe to in bulk
+type ImportCandidate struct {
+	Repo       string
+	Watched    bool   // the user watches the repo on GitHub
+	Starred    bool   // the user starred the repo on GitHub
+	Org        string // organization of the user that owns the repo, if listed for orgs
+	Subscribed bool   // the user already subscribes to the repo
+}
+
+// ImportResult is the outcome of subscribing to one repo with Import
+type ImportResult struct {
+	Repo  string
+	Error string `json:",omitempty"` // empty if the user subscribed to the repo
+}
+
+// ImportCandidates lists the repos that the user watches or starred on GitHub, and the
+// repos of the user's public organizations if withOrgs is set
+func (u User) ImportCandidates(ctx context.Context, withOrgs bool) ([]ImportCandidate, error) {
+	if len(u.Login) == 0 {
+		return nil, fmt.Errorf("Failed to list repos, no GitHub login for user")
+	}
+	watched, err := listRepoNames(ctx, "users/"+u.Login+"/subscriptions")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list watched repos: %v", err)
+	}
+	starred, err := listRepoNames(ctx, "users/"+u.Login+"/starred")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list starred repos: %v", err)
+	}
+	orgRepos := map[string][]string{}
+	if withOrgs {
+		orgs, err := userOrgs(ctx, u.Login)
+		if err != nil {
+			return nil, err
+		}
+		for _, org := range orgs {
+			if orgRepos[org], err = ownerRepos(ctx, org); err != nil {
+				return nil, err
+			}
+		}
+	}
+	subs, err := u.GetSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	subscribed := []string{}
+	for _, sub := range subs {
+		subscribed = append(subscribed, sub.Repo)
+	}
+	return mergeCandidates(watched, starred, orgRepos, subscribed), nil
+}
+
+// mergeCandidates combines watched, starred and organization repos into a list of
+// candidates sorted by repo name
+func mergeCandidates(watched []string, starred []string, orgRepos map[string][]string,
+	subscribed []string) []ImportCandidate {
+
+	candidates := map[string]*ImportCandidate{}
+	get := func(repo string) *ImportCandidate {
+		if c, ok := candidates[repo]; ok {
+			return c
+		}
+		c := &ImportCandidate{Repo: repo}
+		candidates[repo] = c
+		return c
+	}
+	for _, repo := range watched {
+		get(repo).Watched = true
+	}
+	for _, repo := range starred {
+		get(repo).Starred = true
+	}
+	for org, repos := range orgRepos {
+		for _, repo := range repos {
+			get(repo).Org = org
+		}
+	}
+	names := []string{}
+	for repo := range candidates {
+		names = append(names, repo)
+	}
+	sort.Strings(names)
+	subs := newRepoSet(subscribed)
+	results := []ImportCandidate{}
+	for _, repo := range names {
+		c := candidates[repo]
+		c.Subscribed = subs.has(repo)
+		results = append(results, *c)
+	}
+	return results
+}
+
+// Import subscribes the user to repos with pref, sending emails to email or the user's
+// default email if it is empty. Repo data is updated from GitHub for several repos at
+// once. Repos are left out once the GitHub API rate limit is reached, and can be
+// imported again after it resets.
+func (u *User) Import(ctx context.Context, repos []string, pref EmailPreference,
+	email string) []ImportResult {
+
+	results := make([]ImportResult, len(repos))
+	allowed := len(repos)
+	if remaining, err := RateRemaining(ctx); err == nil && remaining-importReserve < allowed {
+		allowed = remaining - importReserve
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	limited := false
+	jobs := make(chan int)
+	for w := 0; w < importWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				skip := limited
+				mu.Unlock()
+				err := ErrRateLimited
+				if !skip {
+					err = UpdateRepo(ctx, repos[i])
+				}
+				if err == ErrRateLimited {
+					mu.Lock()
+					limited = true
+					mu.Unlock()
+				}
+				results[i] = ImportResult{Repo: repos[i]}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range repos {
+		if i >= allowed {
+			results[i] = ImportResult{Repo: repos[i], Error: ErrRateLimited.Error()}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Subscriptions are added one at a time as Subscribe updates u
+	for i := range results {
+		if len(results[i].Error) != 0 {
+			continue
+		}
+		if err := u.Subscribe(repos[i], pref, email); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// listRepoNames lists the full names of the repos returned by a GitHub API path
+func listRepoNames(ctx context.Context, path string) ([]string, error) {
+	names := []string{}
+	err := APIPages(ctx, path, func(body []byte) (bool, error) {
+		var page []apiRepo
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, r := range page {
+			names = append(names, r.FullName)
+		}
+		return true, nil
+	}, "per_page=100")
+	return names, err
+}
+
+// userOrgs lists the logins of the public organizations of a user
+func userOrgs(ctx context.Context, login string) ([]string, error) {
+	orgs := []string{}
+	err := APIPages(ctx, "users/"+login+"/orgs", func(body []byte) (bool, error) {
+		var page []apiUser
+		if err := json.Unmarshal(body, &page); err != nil {
+			return false, err
+		}
+		for _, org := range page {
+			orgs = append(orgs, org.Login)
+		}
+		return true, nil
+	}, "per_page=100")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list organizations of %s: %v", login, err)
+	}
+	return orgs, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestMergeCandidates checks that repos listed more than once are merged into one candidate
+func TestMergeCandidates(t *testing.T) {
+	got := mergeCandidates(
+		[]string{"golang/go", "myorg/api"},
+		[]string{"golang/go", "kubernetes/kubernetes"},
+		map[string][]string{"myorg": {"myorg/api", "myorg/web"}},
+		[]string{"kubernetes/*"},
+	)
+	want := []ImportCandidate{
+		{Repo: "golang/go", Watched: true, Starred: true},
+		{Repo: "kubernetes/kubernetes", Starred: true, Subscribed: true},
+		{Repo: "myorg/api", Watched: true, Org: "myorg"},
+		{Repo: "myorg/web", Org: "myorg"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeCandidates() = %+v, want %+v", got, want)
+	}
+}
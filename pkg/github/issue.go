@@ -18,6 +18,9 @@
 package github
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -36,12 +39,54 @@ Issue holds metadata for GitHub Issues
 type Issue struct {
 	ID        int64     `gorm:"primary_key"` // Github's unique ID for issues created
 	Number    int       // issue number that is specific to a repository
-	Title     string    // title for the issue
+	Title     string    `gorm:"size:1024;"` // title for the issue
 	Author    string    // author's github login name
 	Created   time.Time // timestamp with date of creation
 	UpdatedAt time.Time // timestamp with last update
-	Repo      string    // API url for the issue's parent repo
+	Repo      string    `gorm:"index;"` // API url for the issue's parent repo
 	URL       string    // https url for the issue on github.com
+	Action    string    // last action on the issue received by a webhook, eg "opened"
+	State     string    // "open" or "closed"
+	Body      string    // issue's body, trimmed for display in emails
+	Milestone string    // title of the milestone the issue belongs to
+	Labels    Names     `gorm:"type:TEXT;"` // names of the labels on the issue
+	Assignees Names     `gorm:"type:TEXT;"` // github login names of the assignees
+	// true for pull requests that webhooks stored as issues before they had their own table,
+	// which are flagged by their URL when the tables are migrated
+	PullRequest bool
+}
+
+// Names is a list of names, such as labels or logins, that is stored as a JSON array
+type Names []string
+
+// Value implements driver.Valuer to store the names as a JSON array
+func (n Names) Value() (driver.Value, error) {
+	if n == nil {
+		n = Names{}
+	}
+	b, err := json.Marshal(n)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner to read names stored as a JSON array
+func (n *Names) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*n = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("Failed to scan names from %T", src)
+	}
+	if len(b) == 0 {
+		*n = nil
+		return nil
+	}
+	return json.Unmarshal(b, n)
 }
 
 // IssueFetcher uses information stored to query the githubarchive dataset for issues
@@ -61,8 +106,15 @@ func (f *IssueFetcher) init() {
 		{"issue.updated_at", "created"},
 		{"issue.repository_url", "repo"},
 		{"issue.html_url", "url"},
+		{"issue.state", "state"},
+		{"issue.body", "body"},
+		{"issue.milestone.title", "milestone"},
 	}, "payload").
-		From(f.Opts.getTables()...).
+		Select(bq.Columns{
+			{bq.JExtractJSON("payload", "issue.labels"), "labels"},
+			{bq.JExtractJSON("payload", "issue.assignees"), "assignees"},
+		}).
+		FromTables(f.Opts.getTables()...).
 		And(f.extractConditions()...).
 		OrderBy(f.Opts.getOrder()...).
 		Limit(f.Opts.getLimits())
@@ -70,20 +122,20 @@ func (f *IssueFetcher) init() {
 
 // extractConditions returns set conditions from f.Opts or the default set of conditions
 // for IssueFetcher to use
-func (f *IssueFetcher) extractConditions() []string {
+func (f *IssueFetcher) extractConditions() []bq.Condition {
 	// return set conditions if present
 	if len(f.Opts.Conditions) != 0 {
 		return f.Opts.Conditions
 	}
 	// return default conditions in other cases
-	conditions := []string{}
+	conditions := []bq.Condition{}
 
 	// Add default condition for IssuesEvents
 	conditions = append(conditions, bq.In("type", "IssuesEvent"))
 
 	// add condition for repositories to query from
 	if len(f.Opts.Repositories) != 0 {
-		conditions = append(conditions, bq.In("repo.name", f.Opts.Repositories...))
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
 	}
 
 	// Select only IssueEvents which were opened by default
@@ -135,12 +187,33 @@ func mapToIssue(m map[string]bigquery.Value) Issue {
 	url := m["url"].(string)
 
 	return Issue{
-		ID:      id,
-		Number:  number,
-		Title:   title,
-		Author:  author,
-		Created: created,
-		Repo:    repo,
-		URL:     url,
+		ID:        id,
+		Number:    number,
+		Title:     title,
+		Author:    author,
+		Created:   created,
+		Repo:      repo,
+		URL:       url,
+		State:     valueString(m["state"]),
+		Body:      trimBody(valueString(m["body"])),
+		Milestone: valueString(m["milestone"]),
+		Labels:    jsonNames(valueString(m["labels"]), "name"),
+		Assignees: jsonNames(valueString(m["assignees"]), "login"),
+	}
+}
+
+// jsonNames returns the values of key for a JSON array of objects such as the labels
+// or assignees of an issue, or nil if the array is empty or can't be parsed
+func jsonNames(array string, key string) Names {
+	var objects []map[string]interface{}
+	if err := json.Unmarshal([]byte(array), &objects); err != nil {
+		return nil
+	}
+	var names Names
+	for _, o := range objects {
+		if name, ok := o[key].(string); ok {
+			names = append(names, name)
+		}
 	}
+	return names
 }
@@ -17,6 +17,7 @@
 package github
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
@@ -45,8 +46,8 @@ func TestIssueFetcher(t *testing.T) {
 
 	fetcher := IssueFetcher{
 		Opts: Options{
-			Tables: []string{"ghissues.test_bed"},
-			Conditions: []string{
+			Tables: []bq.Table{{Name: "ghissues.test_bed"}},
+			Conditions: []bq.Condition{
 				bq.In("type", "IssuesEvent"),
 				bq.In("repo_name", "GoogleCloudPlatform/google-cloud-node"),
 				bq.In(bq.JExtract("payload", "action"), "opened"),
@@ -64,3 +65,49 @@ func TestIssueFetcher(t *testing.T) {
 	}
 
 }
+
+// TestJSONNames checks that names are extracted from JSON arrays of labels and assignees
+func TestJSONNames(t *testing.T) {
+	testcases := []struct {
+		array string
+		key   string
+		want  Names
+	}{
+		{`[{"name":"P0","color":"b60205"},{"name":"bug"}]`, "name", Names{"P0", "bug"}},
+		{`[{"login":"octocat","id":1}]`, "login", Names{"octocat"}},
+		{`[]`, "name", nil},
+		{``, "login", nil},
+		{`null`, "login", nil},
+	}
+	for _, tc := range testcases {
+		if got := jsonNames(tc.array, tc.key); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("jsonNames(%q, %q) = %v, want %v", tc.array, tc.key, got, tc.want)
+		}
+	}
+}
+
+// TestNamesScan checks that Names read back the JSON array they are stored as
+func TestNamesScan(t *testing.T) {
+	stored, err := Names{"P0", "help wanted"}.Value()
+	if err != nil {
+		t.Fatalf("Value() failed with error: %v", err)
+	}
+	testcases := []struct {
+		src  interface{}
+		want Names
+	}{
+		{stored, Names{"P0", "help wanted"}},
+		{[]byte(`["a"]`), Names{"a"}},
+		{nil, nil},
+		{"", nil},
+	}
+	for _, tc := range testcases {
+		var got Names
+		if err := got.Scan(tc.src); err != nil {
+			t.Errorf("Scan(%v) failed with error: %v", tc.src, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Scan(%v) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
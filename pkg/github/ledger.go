@@ -0,0 +1,218 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"golang.org/x/net/context"
+)
+
+// SentDigest is an entry of the delivery ledger, which records each address that the
+// digest of a frequency and window was sent to. Email tasks claim the digest with a pending
+// entry before sending, so that retried tasks don't send a digest to the same address
+// twice, and the entry is marked as sent in the same transaction as the notification of
+// the digest.
+type SentDigest struct {
+	ID             uint      `gorm:"primary_key;AUTO_INCREMENT"`
+	UserID         uint64    `gorm:"not null;unique_index:idx_sent_digest"`          // user of the digest, 0 for teams
+	TeamID         uint      `gorm:"not null;unique_index:idx_sent_digest"`          // team of the digest, 0 for users
+	Email          string    `gorm:"not null;size:191;unique_index:idx_sent_digest"` // address the digest was sent to
+	Type           Frequency `gorm:"not null;unique_index:idx_sent_digest"`
+	WindowStart    time.Time `gorm:"not null;unique_index:idx_sent_digest"`
+	WindowEnd      time.Time `gorm:"not null;unique_index:idx_sent_digest"`
+	Pending        bool      `gorm:"not null;default:false"` // claimed by a task that is sending it
+	NotificationID uint
+	CreatedAt      time.Time
+}
+
+// pendingTimeout is how long a pending entry keeps other tasks from sending its digest. A
+// task that is still pending after the deadline of App Engine requests has failed, and the
+// digest may or may not have been sent, so it's sent again.
+const pendingTimeout = 10 * time.Minute
+
+// newSentDigest returns the ledger entry of a digest. Windows are stored in UTC with the
+// precision of the database, so that the entry matches the window of a retried task.
+func newSentDigest(userID uint64, teamID uint, email string, emailType Frequency,
+	w Window) SentDigest {
+
+	return SentDigest{
+		UserID:      userID,
+		TeamID:      teamID,
+		Email:       email,
+		Type:        emailType,
+		WindowStart: w.Start.UTC().Truncate(time.Second),
+		WindowEnd:   w.End.UTC().Truncate(time.Second),
+	}
+}
+
+// expired reports whether the entry was left pending by a task that failed
+func (s SentDigest) expired(now time.Time) bool {
+	return s.Pending && now.Sub(s.CreatedAt) >= pendingTimeout
+}
+
+// ClaimDigest reports whether the digest of emailType for window can be sent to the user
+// at email, and records it in the ledger as pending if so. It can't be sent if it was
+// sent, or if another task is sending it.
+func (u User) ClaimDigest(email string, emailType Frequency, window Window) (bool, error) {
+	return claimDigest(newSentDigest(u.ID, 0, email, emailType, window))
+}
+
+// ClaimDigest reports whether the team digest of emailType for window can be sent to
+// email, and records it in the ledger as pending if so, like User.ClaimDigest
+func (t Team) ClaimDigest(email string, emailType Frequency, window Window) (bool, error) {
+	return claimDigest(newSentDigest(0, t.ID, email, emailType, window))
+}
+
+// ReleaseDigest removes the pending entry of a digest that couldn't be sent to the user
+// at email, so that a retried task sends it
+func (u User) ReleaseDigest(email string, emailType Frequency, window Window) error {
+	return releaseDigest(newSentDigest(u.ID, 0, email, emailType, window))
+}
+
+// ReleaseDigest removes the pending entry of a team digest that couldn't be sent to email
+func (t Team) ReleaseDigest(email string, emailType Frequency, window Window) error {
+	return releaseDigest(newSentDigest(0, t.ID, email, emailType, window))
+}
+
+// whereDigest returns db restricted to the ledger entry with the key of entry
+func whereDigest(db *gorm.DB, entry SentDigest) *gorm.DB {
+	return db.Model(&SentDigest{}).Where(
+		"user_id = ? AND team_id = ? AND email = ? AND type = ? AND "+
+			"window_start = ? AND window_end = ?",
+		entry.UserID, entry.TeamID, entry.Email, entry.Type,
+		entry.WindowStart, entry.WindowEnd)
+}
+
+// claimDigest saves entry as pending, or takes over the entry of a task that failed
+func claimDigest(entry SentDigest) (bool, error) {
+	if DB == nil {
+		return false, fmt.Errorf("Failed to claim delivery, invalid DB Connection")
+	}
+	if entry.WindowEnd.IsZero() {
+		// Payloads from batches stored before windows were recorded
+		return true, nil
+	}
+	var found SentDigest
+	err := whereDigest(DB, entry).First(&found).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return false, fmt.Errorf("Failed to claim delivery, DB Error: %v", err)
+	}
+	now := time.Now()
+	if err == nil {
+		if !found.expired(now) {
+			return false, nil
+		}
+		// Only one of the tasks that find the expired entry takes it over
+		res := DB.Model(&SentDigest{}).Where("id = ? AND pending = ? AND created_at = ?",
+			found.ID, true, found.CreatedAt).Update("created_at", now)
+		if res.Error != nil {
+			return false, fmt.Errorf("Failed to claim delivery, DB Error: %v", res.Error)
+		}
+		return res.RowsAffected == 1, nil
+	}
+	entry.Pending = true
+	entry.CreatedAt = now
+	if err := DB.Create(&entry).Error; err != nil {
+		if duplicate(err) {
+			// Claimed by a task that ran at the same time
+			return false, nil
+		}
+		return false, fmt.Errorf("Failed to claim delivery, DB Error: %v", err)
+	}
+	return true, nil
+}
+
+// releaseDigest removes entry if it's pending
+func releaseDigest(entry SentDigest) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to release delivery, invalid DB Connection")
+	}
+	if entry.WindowEnd.IsZero() {
+		return nil
+	}
+	err := whereDigest(DB, entry).Where("pending = ?", true).Delete(&SentDigest{}).Error
+	if err != nil {
+		return fmt.Errorf("Failed to release delivery to %s, DB Error: %v", entry.Email, err)
+	}
+	return nil
+}
+
+// recordDigest marks the pending entry as sent with db, or saves it if the digest wasn't
+// claimed
+func recordDigest(db *gorm.DB, entry SentDigest) error {
+	if entry.WindowEnd.IsZero() {
+		return nil
+	}
+	res := whereDigest(db, entry).Where("pending = ?", true).Updates(map[string]interface{}{
+		"pending":         false,
+		"notification_id": entry.NotificationID,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("Failed to record delivery to %s, DB Error: %v", entry.Email, res.Error)
+	}
+	if res.RowsAffected != 0 {
+		return nil
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("Failed to record delivery to %s, DB Error: %v", entry.Email, err)
+	}
+	return nil
+}
+
+// AddDigestNotification saves the notifications of the members that a team digest sent
+// to email reached, along with its entry in the delivery ledger, in one transaction. With
+// mark, which is set for the last recipient of the digest, the subscriptions of payload are
+// also marked as notified up to the end of its window in the transaction.
+func (t Team) AddDigestNotification(ctx context.Context,
+	email string, emailType Frequency, payload EmailPayload, mark bool) error {
+
+	if DB == nil {
+		return fmt.Errorf("Failed to save notification, invalid DB Connection")
+	}
+	notifs := []Notification{}
+	for _, member := range t.Members {
+		if len(t.Email) != 0 || member.User.Email == email {
+			notif, err := member.User.newNotification(ctx, email, emailType, payload.Content)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notif)
+		}
+	}
+	entry := newSentDigest(0, t.ID, email, emailType, payload.Window)
+	tx := DB.Begin()
+	for i := range notifs {
+		if err := tx.Create(&notifs[i]).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to save notification, DB Error: %v", err)
+		}
+		entry.NotificationID = notifs[i].ID
+	}
+	if err := recordDigest(tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if mark {
+		if err := markDigest(tx, emailType, payload, entry.NotificationID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSentDigest(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	end := time.Date(2017, 8, 11, 23, 0, 0, 0, usLoc)
+	w := Window{Start: end.AddDate(0, 0, -1), End: end.Add(250 * time.Millisecond)}
+	// The same window in another time zone, as stored by a previous run of the task
+	retried := Window{Start: w.Start.In(berlin), End: end.In(berlin)}
+
+	got := newSentDigest(1, 0, "user@example.com", Daily, w)
+	want := newSentDigest(1, 0, "user@example.com", Daily, retried)
+	if got != want {
+		t.Errorf("newSentDigest() got %+v, wanted %+v", got, want)
+	}
+	if got.WindowEnd.Location() != time.UTC || !got.WindowEnd.Equal(end) {
+		t.Errorf("newSentDigest() got window end %v, wanted %v in UTC", got.WindowEnd, end)
+	}
+}
+
+func TestSentDigestExpired(t *testing.T) {
+	now := time.Date(2017, 8, 11, 12, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		entry SentDigest
+		want  bool
+	}{
+		{SentDigest{Pending: true, CreatedAt: now.Add(-time.Minute)}, false},
+		{SentDigest{Pending: true, CreatedAt: now.Add(-pendingTimeout)}, true},
+		{SentDigest{CreatedAt: now.Add(-time.Hour)}, false},
+	}
+	for _, tc := range testcases {
+		if got := tc.entry.expired(now); got != tc.want {
+			t.Errorf("expired() of %+v got %v, wanted %v", tc.entry, got, tc.want)
+		}
+	}
+}
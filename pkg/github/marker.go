@@ -0,0 +1,178 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"google.golang.org/appengine/log"
+
+	"golang.org/x/net/context"
+)
+
+// maxCatchUp is how far before the start of its usual window the digest of a subscription
+// can start, when digests were missed for longer it starts there instead
+const maxCatchUp = 7 * 24 * time.Hour
+
+// DigestMarker records how far the digests of a frequency have covered the activity of a
+// subscription, so that the next digest starts exactly where the last one ended. Missed
+// cron runs are caught up by the next digest, and retried tasks skip what was sent.
+type DigestMarker struct {
+	SubscriptionID uint      `gorm:"primary_key;auto_increment:false"`
+	Type           Frequency `gorm:"primary_key;auto_increment:false"`
+	NotificationID uint      // last notification sent for the subscription and frequency
+	Until          time.Time // end of the window of the last digest
+}
+
+// FetchDigestData gets email payloads for the digests of emailType for subscriptions that
+// end at the end of window. The window of each subscription starts at the end of its last
+// digest of emailType, or at the start of window for its first one. If name isn't empty
+// its batch is used for the subscriptions whose window matches the batch's window, and the
+// others are fetched from source.
+func FetchDigestData(c context.Context, source EventSource, subscriptions []Subscription,
+	emailType Frequency, window Window, name string) ([]EmailPayload, error) {
+
+	//setup global context to use for logging
+	ctx = c
+	var batch *events
+	if name != "" {
+		data, err := readBatch(name)
+		if err != nil {
+			log.Errorf(ctx, "Failed to use batch %s, fetching data: %v", name, err)
+		} else {
+			batch = &data
+			if !data.Window.End.IsZero() {
+				window = data.Window
+			}
+		}
+	}
+	digests, err := digestWindows(subscriptions, emailType, window)
+	if err != nil {
+		return nil, err
+	}
+	results := []EmailPayload{}
+	for _, digest := range digests {
+		w := digest.Window
+		if batch != nil && w.Start.Equal(window.Start) && w.End.Equal(window.End) {
+			results = append(results, makePayloads(digest.Subscriptions, emailType, *batch)...)
+			continue
+		}
+		data, err := FetchWindowData(ctx, source, digest.Subscriptions, emailType, w)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, data...)
+	}
+	return results, nil
+}
+
+// digestWindows groups subscriptions by the window of their next digest of frequency f,
+// which ends at the end of w. Subscriptions that were already sent a digest up to the end
+// of w are left out.
+func digestWindows(subscriptions []Subscription, f Frequency, w Window) ([]DueDigest, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get digest markers, invalid DB Connection")
+	}
+	ids := []uint{}
+	for _, sub := range subscriptions {
+		ids = append(ids, sub.ID)
+	}
+	markers := []DigestMarker{}
+	if len(ids) != 0 {
+		err := DB.Where("subscription_id in (?) AND type = ?", ids, f).Find(&markers).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groupWindows(subscriptions, markers, w), nil
+}
+
+// groupWindows groups subscriptions by the window from their marker to the end of w
+func groupWindows(subscriptions []Subscription, markers []DigestMarker, w Window) []DueDigest {
+	until := map[uint]time.Time{}
+	for _, m := range markers {
+		until[m.SubscriptionID] = m.Until
+	}
+	digests := []DueDigest{}
+	for _, sub := range subscriptions {
+		start := w.Start
+		if t, ok := until[sub.ID]; ok && !t.IsZero() {
+			if !t.Before(w.End) {
+				continue
+			}
+			start = t.In(w.Start.Location())
+			if earliest := w.Start.Add(-maxCatchUp); start.Before(earliest) {
+				start = earliest
+			}
+		}
+		found := false
+		for i := range digests {
+			if digests[i].Window.Start.Equal(start) {
+				digests[i].Subscriptions = append(digests[i].Subscriptions, sub)
+				found = true
+				break
+			}
+		}
+		if !found {
+			digests = append(digests, DueDigest{
+				Window:        Window{Start: start, End: w.End},
+				Subscriptions: []Subscription{sub},
+			})
+		}
+	}
+	return digests
+}
+
+// MarkDigest marks the subscriptions of payload as notified up to the end of its window
+// without a notification, such as when there was no activity to send
+func MarkDigest(emailType Frequency, payload EmailPayload) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to mark digest, invalid DB Connection")
+	}
+	return markDigest(DB, emailType, payload, 0)
+}
+
+// markDigest saves the markers of the subscriptions of payload with db, along with the
+// notification sent for them if notificationID is set
+func markDigest(db *gorm.DB, emailType Frequency, payload EmailPayload,
+	notificationID uint) error {
+
+	if payload.Window.End.IsZero() {
+		// Payloads from batches stored before windows were recorded
+		return nil
+	}
+	for _, id := range payload.Subscriptions {
+		marker := DigestMarker{SubscriptionID: id, Type: emailType}
+		if err := db.FirstOrInit(&marker, marker).Error; err != nil {
+			return fmt.Errorf("Failed to mark digest, DB Error: %v", err)
+		}
+		marker.Until = payload.Window.End
+		if notificationID != 0 {
+			marker.NotificationID = notificationID
+			err := db.Model(&Subscription{}).Where("id = ?", id).
+				UpdateColumn("last_notification_id", notificationID).Error
+			if err != nil {
+				return fmt.Errorf("Failed to mark digest, DB Error: %v", err)
+			}
+		}
+		if err := db.Save(&marker).Error; err != nil {
+			return fmt.Errorf("Failed to mark digest, DB Error: %v", err)
+		}
+	}
+	return nil
+}
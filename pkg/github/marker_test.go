@@ -0,0 +1,56 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupWindows(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	end := time.Date(2017, 8, 11, 23, 0, 0, 0, usLoc)
+	w := Window{Start: end.AddDate(0, 0, -1), End: end}
+	subs := []Subscription{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	markers := []DigestMarker{
+		{SubscriptionID: 2, Until: w.Start},                   // last digest ended where w starts
+		{SubscriptionID: 3, Until: w.Start.AddDate(0, 0, -2)}, // missed two digests
+		{SubscriptionID: 4, Until: end},                       // already sent
+		{SubscriptionID: 5, Until: end.AddDate(0, 0, -30)},    // missed more than maxCatchUp
+	}
+	got := groupWindows(subs, markers, w)
+	want := map[uint]time.Time{
+		1: w.Start,
+		2: w.Start,
+		3: w.Start.AddDate(0, 0, -2),
+		5: w.Start.Add(-maxCatchUp),
+	}
+	found := map[uint]bool{}
+	for _, digest := range got {
+		if !digest.Window.End.Equal(end) {
+			t.Errorf("groupWindows() got window %v, wanted it to end at %v", digest.Window, end)
+		}
+		for _, sub := range digest.Subscriptions {
+			found[sub.ID] = true
+			if start, ok := want[sub.ID]; !ok || !digest.Window.Start.Equal(start) {
+				t.Errorf("groupWindows() got window %v for subscription %d, wanted start %v",
+					digest.Window, sub.ID, start)
+			}
+		}
+	}
+	if len(got) != 3 || len(found) != len(want) {
+		t.Errorf("groupWindows() got %v, wanted 3 windows for subscriptions 1, 2, 3 and 5", got)
+	}
+}
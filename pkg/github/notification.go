@@ -46,38 +46,81 @@ func (u User) AddNotification(
 
 	if DB == nil {
 		log.Errorf(ctx, "Failed to save notification, invalid DB Connection")
+		return
 	}
 	if DB.First(&User{}, "id = ?", u.ID).RecordNotFound() == false {
-		notif := Notification{
-			UserID: u.ID,
-			Email:  email,
-			Type:   emailType,
+		notif, err := u.newNotification(ctx, email, emailType, data)
+		if err != nil {
+			log.Errorf(ctx, "%v", err)
+		} else if err := DB.Create(&notif).Error; err != nil {
+			log.Errorf(ctx, "Failed to save notification, DB Error: %v", err)
 		}
-		repos := []repoJSON{}
-		// item holds one subscription's email payload
-		for _, item := range data {
-			r := repoJSON{
-				Repo: item.RepoName,
-			}
-			UpdateRepo(ctx, item.RepoName)
-			repoData, err := u.GetRepos(item.RepoName)
-			if err != nil || len(repoData) != 1 {
-				log.Errorf(ctx, "Failed to save notification, invalid data for repository: %v", err)
-				continue
-			}
-			r.Issues = repoData[0].IssuesOpen
-			repos = append(repos, r)
+	}
+}
+
+// AddDigestNotification saves the notification for a digest sent to the user at email
+// with its entry in the delivery ledger, and marks the subscriptions of payload as notified
+// up to the end of its window, in one transaction so that the next digest starts where
+// this one ended
+func (u User) AddDigestNotification(ctx context.Context,
+	email string, emailType Frequency, payload EmailPayload) error {
+
+	if DB == nil {
+		return fmt.Errorf("Failed to save notification, invalid DB Connection")
+	}
+	notif, err := u.newNotification(ctx, email, emailType, payload.Content)
+	if err != nil {
+		return err
+	}
+	tx := DB.Begin()
+	if err := tx.Create(&notif).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to save notification, DB Error: %v", err)
+	}
+	entry := newSentDigest(u.ID, 0, email, emailType, payload.Window)
+	entry.NotificationID = notif.ID
+	if err := recordDigest(tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := markDigest(tx, emailType, payload, notif.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// newNotification returns the notification for a digest with data sent to the user at
+// email, with the number of open issues of each repo
+func (u User) newNotification(ctx context.Context,
+	email string, emailType Frequency, data []Payload) (Notification, error) {
+
+	notif := Notification{
+		UserID: u.ID,
+		Email:  email,
+		Type:   emailType,
+	}
+	repos := []repoJSON{}
+	// item holds one subscription's email payload
+	for _, item := range data {
+		r := repoJSON{
+			Repo: item.RepoName,
 		}
-		repoString, err := json.Marshal(repos)
-		if err != nil {
-			log.Errorf(ctx, "Failed to save notification, error converting to JSON: %v", err)
-		} else {
-			notif.Repos = string(repoString)
-			if DB.Create(&notif).Error != nil {
-				log.Errorf(ctx, "Failed to save notification, DB Error: %v", err)
-			}
+		UpdateRepo(ctx, item.RepoName)
+		repoData, err := u.GetRepos(item.RepoName)
+		if err != nil || len(repoData) != 1 {
+			log.Errorf(ctx, "Failed to save notification, invalid data for repository: %v", err)
+			continue
 		}
+		r.Issues = repoData[0].IssuesOpen
+		repos = append(repos, r)
+	}
+	repoString, err := json.Marshal(repos)
+	if err != nil {
+		return notif, fmt.Errorf("Failed to save notification, error converting to JSON: %v", err)
 	}
+	notif.Repos = string(repoString)
+	return notif, nil
 }
 
 // GetNotifications returns all notifications sent to a user if emailType is 0
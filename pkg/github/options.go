@@ -15,22 +15,26 @@
 package github
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
 )
 
+// defaultLimit is the number of results returned by a query when Options.Limit isn't set
+const defaultLimit = 10
+
 // Options allows for additional configuration of the query
 type Options struct {
-	Tables       []string // To override the default tables - when extending the query for different dates
-	Repositories []string // To set repositories to fetch Issues From
-	Kind         []string // To set the Kinds of Event to select - eg "opened", "closed",etc
-	Order        []string // To override default fields for use in OrderBy Clause
-	Limit        uint64   // To override default limit value
-	Conditions   []string // To override all conditions for the Query
+	Tables       []bq.Table     // To override the default tables - when extending the query for different dates
+	Repositories []string       // To set repositories to fetch Issues From
+	Kind         []string       // To set the Kinds of Event to select - eg "opened", "closed",etc
+	Order        []string       // To override default fields for use in OrderBy Clause
+	Limit        uint64         // To override default limit value
+	Conditions   []bq.Condition // To override all conditions for the Query
 }
 
 // getTables returns set tables or the default table for today's data
-func (o *Options) getTables() []string {
+func (o *Options) getTables() []bq.Table {
 	// return set tables if present
 	if len(o.Tables) != 0 {
 		return o.Tables
@@ -39,7 +43,7 @@ func (o *Options) getTables() []string {
 	// By default uses today's githubarchive table
 	usLoc, _ := time.LoadLocation("America/Los_Angeles")
 	today := time.Now().In(usLoc).Format("20060102")
-	return []string{"githubarchive.day." + today}
+	return []bq.Table{{Name: subTable("day") + today}}
 }
 
 // getOrder returns the set of fields to use to sort the result by or the default sort fields
@@ -59,32 +63,19 @@ func (o *Options) getLimits() uint64 {
 		return o.Limit
 	}
 	// Return default limit otherwise
-	return 10
+	return defaultLimit
 }
 
-// SetTables sets the default table values for the given frequency type
-// If an invalid frequency is passed, it returns the default table for today's github events
-func (o *Options) SetTables(f Frequency) {
-
-	usLoc, _ := time.LoadLocation("America/Los_Angeles")
-	today := time.Now().In(usLoc)
-	if f == Weekly {
-		weekStart := today.AddDate(0, 0, -7).Format("2006-01-02")
-		weekEnd := today.Format("2006-01-02")
-		week := weekTableRange(weekStart, weekEnd)
-		o.Tables = []string{week}
-	} else if f == Monthly {
-		month := subTable("month") + today.Format("200601")
-		o.Tables = []string{month}
-	} else {
-		day := subTable("day") + today.Format("20060102")
-		o.Tables = []string{day}
+// SetWindow sets the tables of daily githubarchive events covering the days of w,
+// githubarchive tables are named by their UTC day
+func (o *Options) SetWindow(w Window) {
+	start := w.Start.UTC().Format("20060102")
+	end := w.End.UTC().Format("20060102")
+	if start == end || !w.Start.Before(w.End) {
+		o.Tables = []bq.Table{{Name: subTable("day") + end}}
+		return
 	}
-}
-
-func weekTableRange(start, end string) string {
-	return fmt.Sprintf(`(TABLE_DATE_RANGE([%s],TIMESTAMP('%s'),TIMESTAMP('%s')))`,
-		subTable("day"), start, end)
+	o.Tables = []bq.Table{bq.DateRange(subTable("day"), w.Start.UTC(), w.End.UTC())}
 }
 
 func subTable(subTable string) string {
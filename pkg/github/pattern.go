@@ -0,0 +1,223 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
+
+	"github.com/jinzhu/gorm"
+
+	"golang.org/x/net/context"
+)
+
+// Subscriptions can be for a single repo such as "myorg/service", for all repos of an
+// organization or user with "myorg/*", or for the repos matching a glob such as
+// "myorg/service-*". Patterns are resolved when events are fetched, so repos that are
+// created later are covered without subscribing again.
+
+// IsRepoPattern reports whether repo is a pattern instead of the name of a single repo
+func IsRepoPattern(repo string) bool {
+	return strings.Contains(repo, "*")
+}
+
+// ValidRepoPattern returns an error unless pattern has an owner without wildcards and
+// a name with "*" wildcards. Other glob syntax isn't allowed, as it isn't converted for
+// the LIKE conditions of queries.
+func ValidRepoPattern(pattern string) error {
+	parts := strings.Split(pattern, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return fmt.Errorf("Invalid repo pattern %q, expected owner/name", pattern)
+	}
+	if IsRepoPattern(parts[0]) {
+		return fmt.Errorf("Invalid repo pattern %q, the owner can't have wildcards", pattern)
+	}
+	if strings.ContainsAny(pattern, `?[]\`) {
+		return fmt.Errorf("Invalid repo pattern %q, only * wildcards are allowed", pattern)
+	}
+	return nil
+}
+
+// matchRepo reports whether the repo name matches pattern, ignoring case like GitHub
+func matchRepo(pattern string, name string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
+
+// SubscribedRepo returns the repo or pattern of the subscription in subscriptions that
+// covers the repo name, preferring a subscription to the repo itself over patterns
+func SubscribedRepo(subscriptions []Subscription, name string) (string, bool) {
+	pattern := ""
+	for _, sub := range subscriptions {
+		if sub.Repo == name {
+			return sub.Repo, true
+		}
+		if len(pattern) == 0 && IsRepoPattern(sub.Repo) && matchRepo(sub.Repo, name) {
+			pattern = sub.Repo
+		}
+	}
+	return pattern, len(pattern) != 0
+}
+
+// splitRepos separates the names of single repos from patterns
+func splitRepos(repos []string) (names []string, patterns []string) {
+	for _, repo := range repos {
+		if IsRepoPattern(repo) {
+			patterns = append(patterns, repo)
+		} else {
+			names = append(names, repo)
+		}
+	}
+	return names, patterns
+}
+
+// repoSet holds repo names and patterns to check which repos events belong to
+type repoSet struct {
+	names    map[string]bool
+	patterns []string
+	// subscriptions that claim repos, if set a repo is only in the set if the subscription
+	// that covers it, as returned by SubscribedRepo, is one of names or patterns
+	subscriptions []Subscription
+}
+
+// newRepoSet returns a repoSet for repos, which can be names or patterns
+func newRepoSet(repos []string) repoSet {
+	names, patterns := splitRepos(repos)
+	return repoSet{names: listToSet(names), patterns: patterns}
+}
+
+// newSubscribedRepoSet returns a repoSet for repos, which are some of the repos of
+// subscriptions. Repos covered by one of the other subscriptions aren't in the set, so that
+// a subscription for a repo takes precedence over the patterns that match it.
+func newSubscribedRepoSet(repos []string, subscriptions []Subscription) repoSet {
+	s := newRepoSet(repos)
+	s.subscriptions = subscriptions
+	return s
+}
+
+// has reports whether name is one of the repos of s or matches one of its patterns
+func (s repoSet) has(name string) bool {
+	if s.subscriptions != nil {
+		repo, ok := SubscribedRepo(s.subscriptions, name)
+		if !ok || s.names[repo] {
+			return ok
+		}
+		for _, pattern := range s.patterns {
+			if pattern == repo {
+				return true
+			}
+		}
+		return false
+	}
+	if s.names[name] {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		if matchRepo(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// likePattern converts the wildcards of a repo pattern for use with LIKE
+func likePattern(pattern string) string {
+	pattern = strings.Replace(pattern, `\`, `\\`, -1)
+	pattern = strings.Replace(pattern, "%", `\%`, -1)
+	pattern = strings.Replace(pattern, "_", `\_`, -1)
+	return strings.Replace(pattern, "*", "%", -1)
+}
+
+// repoCondition limits githubarchive events to repos, with a LIKE condition for patterns
+func repoCondition(repos []string) bq.Condition {
+	names, patterns := splitRepos(repos)
+	conditions := []bq.Condition{}
+	if len(names) != 0 {
+		conditions = append(conditions, bq.In("repo.name", names...))
+	}
+	likes := []string{}
+	for _, pattern := range patterns {
+		likes = append(likes, strings.ToLower(likePattern(pattern)))
+	}
+	if len(likes) != 0 {
+		conditions = append(conditions, bq.Like("LOWER(repo.name)", likes...))
+	}
+	return bq.Any(conditions...)
+}
+
+// whereRepos limits stored activity to repos, with a LIKE condition for patterns
+func whereRepos(repos []string) *gorm.DB {
+	names, patterns := splitRepos(repos)
+	conditions := []string{}
+	args := []interface{}{}
+	if len(names) != 0 {
+		conditions = append(conditions, "repo in (?)")
+		args = append(args, repoURLs(names))
+	}
+	for _, pattern := range patterns {
+		conditions = append(conditions, "repo LIKE ?")
+		args = append(args, endpoint+repoAPI+likePattern(pattern))
+	}
+	return DB.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// ExpandRepos returns repos with patterns replaced by the names of the repos that match
+// them, which are listed with the GitHub API for the organization or user of the pattern
+func ExpandRepos(ctx context.Context, repos ...string) ([]string, error) {
+	names, patterns := splitRepos(repos)
+	if len(patterns) == 0 {
+		return repos, nil
+	}
+	listed := map[string][]string{} // repos of each owner
+	seen := listToSet(names)
+	for _, pattern := range patterns {
+		if err := ValidRepoPattern(pattern); err != nil {
+			return nil, err
+		}
+		owner := strings.Split(pattern, "/")[0]
+		if _, ok := listed[owner]; !ok {
+			found, err := ownerRepos(ctx, owner)
+			if err != nil {
+				return nil, err
+			}
+			listed[owner] = found
+		}
+		for _, name := range listed[owner] {
+			if matchRepo(pattern, name) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// ownerRepos lists the names of the repos of an organization, or of a user if owner
+// isn't an organization
+func ownerRepos(ctx context.Context, owner string) ([]string, error) {
+	names, err := listRepoNames(ctx, "orgs/"+owner+"/repos")
+	if err != nil {
+		names, err = listRepoNames(ctx, "users/"+owner+"/repos")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list repos of %s: %v", owner, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
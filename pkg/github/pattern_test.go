@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRepoSet checks that repos match the names and patterns of subscriptions
+func TestRepoSet(t *testing.T) {
+	set := newRepoSet([]string{"golang/go", "kubernetes/*", "GoogleCloudPlatform/google-cloud-*"})
+	testcases := []struct {
+		repo string
+		want bool
+	}{
+		{"golang/go", true},
+		{"golang/tools", false},
+		{"kubernetes/kubernetes", true},
+		{"kubernetes/test-infra", true},
+		{"kubernetes-sigs/kind", false},
+		{"GoogleCloudPlatform/google-cloud-go", true},
+		{"googlecloudplatform/google-cloud-node", true},
+		{"GoogleCloudPlatform/golang-samples", false},
+	}
+	for _, tc := range testcases {
+		if got := set.has(tc.repo); got != tc.want {
+			t.Errorf("has(%q) = %v, want %v", tc.repo, got, tc.want)
+		}
+	}
+}
+
+// TestSubscribedRepoSet checks that repos with their own subscription, or covered by an
+// earlier pattern, aren't in the set of a pattern
+func TestSubscribedRepoSet(t *testing.T) {
+	subs := []Subscription{{Repo: "kubernetes/test-*"}, {Repo: "kubernetes/*"},
+		{Repo: "kubernetes/kubernetes"}}
+	set := newSubscribedRepoSet([]string{"kubernetes/*"}, subs)
+	testcases := []struct {
+		repo string
+		want bool
+	}{
+		{"kubernetes/kubernetes", false},
+		{"kubernetes/test-infra", false},
+		{"kubernetes/website", true},
+		{"golang/go", false},
+	}
+	for _, tc := range testcases {
+		if got := set.has(tc.repo); got != tc.want {
+			t.Errorf("has(%q) = %v, want %v", tc.repo, got, tc.want)
+		}
+	}
+}
+
+// TestRepoCondition checks the BigQuery condition for repo names and patterns
+func TestRepoCondition(t *testing.T) {
+	testcases := []struct {
+		repos    []string
+		wantExpr string
+		wantArgs []interface{}
+	}{
+		{
+			[]string{"golang/go"},
+			"(repo.name IN ?)",
+			[]interface{}{[]string{"golang/go"}},
+		},
+		{
+			[]string{"golang/go", "Kubernetes/*", "myorg/my_service-*"},
+			"(repo.name IN ? OR (LOWER(repo.name) LIKE ? OR LOWER(repo.name) LIKE ?))",
+			[]interface{}{[]string{"golang/go"}, "kubernetes/%", `myorg/my\_service-%`},
+		},
+	}
+	for _, tc := range testcases {
+		got := repoCondition(tc.repos)
+		if got.Expr != tc.wantExpr || !reflect.DeepEqual(got.Args, tc.wantArgs) {
+			t.Errorf("repoCondition(%v) = %q %v, want %q %v", tc.repos, got.Expr, got.Args,
+				tc.wantExpr, tc.wantArgs)
+		}
+	}
+}
+
+// TestValidRepoPattern checks that wildcards are only allowed in repo names
+func TestValidRepoPattern(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"myorg/*", true},
+		{"myorg/service-*", true},
+		{"*/service", false},
+		{"myorg", false},
+		{"myorg/*/x", false},
+		{"myorg/service-?", false},
+		{"myorg/[a-z]*", false},
+		{`myorg/\*`, false},
+	}
+	for _, tc := range testcases {
+		if err := ValidRepoPattern(tc.pattern); (err == nil) != tc.valid {
+			t.Errorf("ValidRepoPattern(%q) = %v, want valid %v", tc.pattern, err, tc.valid)
+		}
+	}
+}
+
+// TestSubscribedRepo checks that repos are covered by their own subscription or a pattern
+func TestSubscribedRepo(t *testing.T) {
+	subs := []Subscription{{Repo: "kubernetes/*"}, {Repo: "golang/go"}, {Repo: "kubernetes/kubernetes"}}
+	testcases := []struct {
+		repo string
+		want string
+	}{
+		{"golang/go", "golang/go"},
+		{"kubernetes/kubernetes", "kubernetes/kubernetes"},
+		{"kubernetes/test-infra", "kubernetes/*"},
+		{"golang/tools", ""},
+	}
+	for _, tc := range testcases {
+		if got, ok := SubscribedRepo(subs, tc.repo); got != tc.want || ok != (tc.want != "") {
+			t.Errorf("SubscribedRepo(%q) = %q, %v, want %q", tc.repo, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigquery"
+
+	"google.golang.org/api/iterator"
+)
+
+/*
+PullRequest holds metadata for an event on a GitHub Pull Request
+*/
+type PullRequest struct {
+	ID        int64     `gorm:"primary_key"` // Github's unique ID for pull requests created
+	Number    int       // pull request number that is specific to a repository
+	Title     string    `gorm:"size:1024;"` // title for the pull request
+	Author    string    // author's github login name
+	Actor     string    // login of the user who merged, closed or requested a review
+	Reviewer  string    // login of the requested reviewer for "review_requested"
+	Action    string    // "opened", "merged", "closed" or "review_requested"
+	Created   time.Time // timestamp of the event
+	UpdatedAt time.Time // timestamp with last update
+	Repo      string    `gorm:"index;"` // API url for the pull request's parent repo
+	URL       string    // https url for the pull request on github.com
+}
+
+/*
+Review holds metadata for reviews and review comments on GitHub Pull Requests
+*/
+type Review struct {
+	ID         int64     `gorm:"primary_key;auto_increment:false"` // Github's unique ID for the review or comment
+	Comment    bool      `gorm:"primary_key"`                      // true for a review comment on the diff
+	PullNumber int       // number of the reviewed pull request
+	PullTitle  string    `gorm:"size:1024;"` // title of the reviewed pull request, if known
+	Author     string    // reviewer's github login name
+	State      string    // "approved", "changes_requested" or "commented" for reviews
+	Body       string    // review's body
+	Created    time.Time // timestamp with date of creation
+	UpdatedAt  time.Time // timestamp with last update
+	Repo       string    `gorm:"index;"` // API url for the pull request's parent repo
+	URL        string    // https url for the review on github.com
+}
+
+// PullRequestFetcher uses information stored to query the githubarchive dataset for
+// pull request events
+type PullRequestFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// init sets up the default query for the PullRequestFetcher
+func (f *PullRequestFetcher) init() {
+
+	f.query = bq.Select(bq.Columns{
+		{"pull_request.id", "id"},
+		{"pull_request.number", "number"},
+		{"pull_request.title", "title"},
+		{"pull_request.user.login", "author"},
+		{"pull_request.merged", "merged"},
+		{"pull_request.base.repo.url", "repo"},
+		{"pull_request.html_url", "url"},
+		{"requested_reviewer.login", "reviewer"},
+		{"action", "action"},
+	}, "payload").
+		Select(bq.Columns{
+			{"actor.login", "actor"},
+			{"created_at", "created"},
+		}).
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		OrderBy(f.Opts.getOrder()...).
+		Limit(f.Opts.getLimits())
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for PullRequestFetcher to use
+func (f *PullRequestFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{}
+
+	// Add default condition for PullRequestEvents
+	conditions = append(conditions, bq.In("type", "PullRequestEvent"))
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+
+	// Select only pull requests which were opened by default
+	if len(f.Opts.Kind) == 0 {
+		f.Opts.Kind = append(f.Opts.Kind, "opened")
+	}
+	conditions = append(conditions, bq.In(bq.JExtract("payload", "action"), f.Opts.Kind...))
+	return conditions
+}
+
+// Fetch uses the data stored in PullRequestFetcher and runs a query job on BigQuery
+func (f *PullRequestFetcher) Fetch(ctx context.Context) ([]PullRequest, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	var pulls []PullRequest
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		pulls = append(pulls, mapToPullRequest(m))
+	}
+	return pulls, nil
+}
+
+// mapToPullRequest converts a map of results from BigQuery to PullRequest Objects
+func mapToPullRequest(m map[string]bigquery.Value) PullRequest {
+	id, err := strconv.ParseInt(valueString(m["id"]), 10, 64)
+	if err != nil {
+		id = -1
+	}
+	number, err := strconv.Atoi(valueString(m["number"]))
+	if err != nil {
+		number = -1
+	}
+	action := valueString(m["action"])
+	if action == "closed" && valueString(m["merged"]) == "true" {
+		action = "merged"
+	}
+	created, _ := m["created"].(time.Time)
+
+	return PullRequest{
+		ID:       id,
+		Number:   number,
+		Title:    valueString(m["title"]),
+		Author:   valueString(m["author"]),
+		Actor:    valueString(m["actor"]),
+		Reviewer: valueString(m["reviewer"]),
+		Action:   action,
+		Created:  created,
+		Repo:     valueString(m["repo"]),
+		URL:      valueString(m["url"]),
+	}
+}
+
+// ReviewFetcher uses information stored to query the githubarchive dataset for reviews
+// with PullRequestReviewEvents, or for review comments with PullRequestReviewCommentEvents
+// when Opts.Kind is "review_comment"
+type ReviewFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// isComment returns true if the fetcher queries review comments
+func (f *ReviewFetcher) isComment() bool {
+	return len(f.Opts.Kind) != 0 && f.Opts.Kind[0] == "review_comment"
+}
+
+// init sets up the default query for the ReviewFetcher
+func (f *ReviewFetcher) init() {
+
+	root := "review"
+	if f.isComment() {
+		root = "comment"
+	}
+	f.query = bq.Select(bq.Columns{
+		{root + ".id", "id"},
+		{root + ".user.login", "author"},
+		{root + ".state", "state"},
+		{root + ".body", "body"},
+		{root + ".html_url", "url"},
+		{"pull_request.number", "number"},
+		{"pull_request.title", "title"},
+		{"pull_request.base.repo.url", "repo"},
+	}, "payload").
+		Select(bq.Columns{
+			{"created_at", "created"},
+		}).
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		OrderBy(f.Opts.getOrder()...).
+		Limit(f.Opts.getLimits())
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for ReviewFetcher to use
+func (f *ReviewFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{}
+
+	// Add default condition for the type of event
+	if f.isComment() {
+		conditions = append(conditions, bq.In("type", "PullRequestReviewCommentEvent"))
+	} else {
+		conditions = append(conditions, bq.In("type", "PullRequestReviewEvent"))
+	}
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+	return conditions
+}
+
+// Fetch uses the data stored in ReviewFetcher and runs a query job on BigQuery
+func (f *ReviewFetcher) Fetch(ctx context.Context) ([]Review, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	var reviews []Review
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		review := mapToReview(m)
+		review.Comment = f.isComment()
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+// mapToReview converts a map of results from BigQuery to Review Objects
+func mapToReview(m map[string]bigquery.Value) Review {
+	id, err := strconv.ParseInt(valueString(m["id"]), 10, 64)
+	if err != nil {
+		id = -1
+	}
+	number, err := strconv.Atoi(valueString(m["number"]))
+	if err != nil {
+		number = -1
+	}
+	created, _ := m["created"].(time.Time)
+
+	return Review{
+		ID:         id,
+		PullNumber: number,
+		PullTitle:  valueString(m["title"]),
+		Author:     valueString(m["author"]),
+		State:      reviewState(valueString(m["state"])),
+		Body:       trimBody(valueString(m["body"])),
+		Created:    created,
+		Repo:       valueString(m["repo"]),
+		URL:        valueString(m["url"]),
+	}
+}
+
+// reviewState returns the state of a review in lower case, githubarchive and the
+// GitHub API use "APPROVED" while webhooks use "approved"
+func reviewState(state string) string {
+	return strings.ToLower(state)
+}
+
+// valueString returns v as a string, or an empty string for NULL values
+func valueString(v bigquery.Value) string {
+	s, _ := v.(string)
+	return s
+}
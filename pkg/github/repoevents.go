@@ -0,0 +1,390 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigquery"
+
+	"google.golang.org/api/iterator"
+)
+
+/*
+Release holds metadata for a published GitHub release
+*/
+type Release struct {
+	ID      int64     `gorm:"primary_key"` // Github's unique ID for releases
+	TagName string    // tag of the release
+	Name    string    // title of the release
+	Author  string    // login of the user who published the release
+	Created time.Time // timestamp of publishing
+	Repo    string    `gorm:"index;"` // API url for the release's repo
+	URL     string    // https url for the release on github.com
+}
+
+/*
+Fork holds metadata for a fork of a GitHub repository
+*/
+type Fork struct {
+	ID       int64     `gorm:"primary_key"` // Github's unique ID for the forked repo
+	FullName string    // name of the forked repo, eg "owner/repo"
+	Owner    string    // login of the owner of the forked repo
+	Created  time.Time // timestamp of forking
+	Repo     string    `gorm:"index;"` // API url for the parent repo
+	URL      string    // https url for the forked repo on github.com
+}
+
+/*
+Star holds a star given to a GitHub repository, once for each user
+*/
+type Star struct {
+	ID      uint      `gorm:"primary_key;AUTO_INCREMENT"`
+	User    string    `gorm:"unique_index:idx_star_user_repo;not null;"` // login of the user who starred the repo
+	Created time.Time // timestamp of starring
+	Repo    string    `gorm:"index;unique_index:idx_star_user_repo;not null;"` // API url for the starred repo
+}
+
+// ReleaseFetcher uses information stored to query the githubarchive dataset for releases
+type ReleaseFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// init sets up the default query for the ReleaseFetcher
+func (f *ReleaseFetcher) init() {
+
+	f.query = bq.Select(bq.Columns{
+		{"release.id", "id"},
+		{"release.tag_name", "tag"},
+		{"release.name", "name"},
+		{"release.author.login", "author"},
+		{"release.html_url", "url"},
+	}, "payload").
+		Select(bq.Columns{
+			{"repo.url", "repo"},
+			{"created_at", "created"},
+		}).
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		OrderBy(f.Opts.getOrder()...).
+		Limit(f.Opts.getLimits())
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for ReleaseFetcher to use
+func (f *ReleaseFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{}
+
+	// Add default condition for ReleaseEvents
+	conditions = append(conditions, bq.In("type", "ReleaseEvent"))
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+	return conditions
+}
+
+// Fetch uses the data stored in ReleaseFetcher and runs a query job on BigQuery
+func (f *ReleaseFetcher) Fetch(ctx context.Context) ([]Release, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Release
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, mapToRelease(m))
+	}
+	return releases, nil
+}
+
+// mapToRelease converts a map of results from BigQuery to Release Objects
+func mapToRelease(m map[string]bigquery.Value) Release {
+	id, err := strconv.ParseInt(valueString(m["id"]), 10, 64)
+	if err != nil {
+		id = -1
+	}
+	created, _ := m["created"].(time.Time)
+
+	return Release{
+		ID:      id,
+		TagName: valueString(m["tag"]),
+		Name:    valueString(m["name"]),
+		Author:  valueString(m["author"]),
+		Created: created,
+		Repo:    valueString(m["repo"]),
+		URL:     valueString(m["url"]),
+	}
+}
+
+// ForkFetcher uses information stored to query the githubarchive dataset for forks
+type ForkFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// init sets up the default query for the ForkFetcher
+func (f *ForkFetcher) init() {
+
+	// Forks have no author to sort by, so the newest come first by default
+	order := f.Opts.Order
+	if len(order) == 0 {
+		order = []string{"created DESC", "id DESC"}
+	}
+	f.query = bq.Select(bq.Columns{
+		{"forkee.id", "id"},
+		{"forkee.full_name", "name"},
+		{"forkee.owner.login", "owner"},
+		{"forkee.html_url", "url"},
+	}, "payload").
+		Select(bq.Columns{
+			{"repo.url", "repo"},
+			{"created_at", "created"},
+		}).
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		OrderBy(order...).
+		Limit(f.Opts.getLimits())
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for ForkFetcher to use
+func (f *ForkFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{}
+
+	// Add default condition for ForkEvents
+	conditions = append(conditions, bq.In("type", "ForkEvent"))
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+	return conditions
+}
+
+// Fetch uses the data stored in ForkFetcher and runs a query job on BigQuery
+func (f *ForkFetcher) Fetch(ctx context.Context) ([]Fork, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	var forks []Fork
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		forks = append(forks, mapToFork(m))
+	}
+	return forks, nil
+}
+
+// mapToFork converts a map of results from BigQuery to Fork Objects
+func mapToFork(m map[string]bigquery.Value) Fork {
+	id, err := strconv.ParseInt(valueString(m["id"]), 10, 64)
+	if err != nil {
+		id = -1
+	}
+	created, _ := m["created"].(time.Time)
+
+	return Fork{
+		ID:       id,
+		FullName: valueString(m["name"]),
+		Owner:    valueString(m["owner"]),
+		Created:  created,
+		Repo:     valueString(m["repo"]),
+		URL:      valueString(m["url"]),
+	}
+}
+
+// StarFetcher uses information stored to count the stars given to repos in the
+// githubarchive dataset, which records them as WatchEvents
+type StarFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// init sets up the default query for the StarFetcher
+func (f *StarFetcher) init() {
+
+	f.query = bq.Select(bq.Columns{
+		{"repo.name", "repo"},
+		{bq.Count("*"), "stars"},
+	}).
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		GroupBy("repo.name")
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for StarFetcher to use
+func (f *StarFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{}
+
+	// Add default condition for WatchEvents
+	conditions = append(conditions, bq.In("type", "WatchEvent"))
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+	return conditions
+}
+
+// Fetch uses the data stored in StarFetcher and runs a query job on BigQuery, it returns
+// the number of stars for each repo name
+func (f *StarFetcher) Fetch(ctx context.Context) (map[string]int, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	stars := map[string]int{}
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		count, _ := m["stars"].(int64)
+		stars[valueString(m["repo"])] = int(count)
+	}
+	return stars, nil
+}
+
+/*
+RepoActivity holds counts of the issue activity on a GitHub repository
+*/
+type RepoActivity struct {
+	Repo       string // name of the repo, eg "owner/repo"
+	Opened     int    // number of issues opened
+	Closed     int    // number of issues closed
+	Commenters int    // number of distinct users who commented on issues
+}
+
+// ActivityFetcher uses information stored to count the opened and closed issues and the
+// distinct commenters of repos in the githubarchive dataset with a single query
+type ActivityFetcher struct {
+	query bq.SelectBuilder
+	Opts  Options
+}
+
+// init sets up the default query for the ActivityFetcher
+func (f *ActivityFetcher) init() {
+	issues := bq.In("type", "IssuesEvent")
+	action := bq.JExtract("payload", "action")
+	f.query = bq.Select(bq.Columns{{"repo.name", "repo"}}).
+		SelectAs(bq.CountIf(bq.All(issues, bq.Expr(action+" = ?", "opened"))), "opened").
+		SelectAs(bq.CountIf(bq.All(issues, bq.Expr(action+" = ?", "closed"))), "closed").
+		SelectAs(bq.CountDistinctIf("actor.login", bq.In("type", "IssueCommentEvent")),
+			"commenters").
+		FromTables(f.Opts.getTables()...).
+		And(f.extractConditions()...).
+		GroupBy("repo.name")
+}
+
+// extractConditions returns set conditions from f.Opts or the default set of conditions
+// for ActivityFetcher to use
+func (f *ActivityFetcher) extractConditions() []bq.Condition {
+	// return set conditions if present
+	if len(f.Opts.Conditions) != 0 {
+		return f.Opts.Conditions
+	}
+	// return default conditions in other cases
+	conditions := []bq.Condition{bq.In("type", "IssuesEvent", "IssueCommentEvent")}
+
+	// add condition for repositories to query from
+	if len(f.Opts.Repositories) != 0 {
+		conditions = append(conditions, repoCondition(f.Opts.Repositories))
+	}
+	return conditions
+}
+
+// Fetch uses the data stored in ActivityFetcher and runs a query job on BigQuery, it
+// returns the counts of each repo with activity
+func (f *ActivityFetcher) Fetch(ctx context.Context) ([]RepoActivity, error) {
+	f.init()
+	results, err := bq.Fetch(ctx, f.query)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := []RepoActivity{}
+
+	for {
+		var m map[string]bigquery.Value
+		err := results.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		opened, _ := m["opened"].(int64)
+		closed, _ := m["closed"].(int64)
+		commenters, _ := m["commenters"].(int64)
+		activity = append(activity, RepoActivity{
+			Repo:       valueString(m["repo"]),
+			Opened:     int(opened),
+			Closed:     int(closed),
+			Commenters: int(commenters),
+		})
+	}
+	return activity, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
+)
+
+// TestForkQuery checks that the fork query only sorts by columns that it selects
+func TestForkQuery(t *testing.T) {
+	f := ForkFetcher{Opts: Options{
+		Tables:       []bq.Table{{Name: "githubarchive.day.20170701"}},
+		Repositories: []string{"golang/go"},
+	}}
+	f.init()
+	got, err := f.query.SQL()
+	if err != nil {
+		t.Fatalf("ForkFetcher query failed with error: %v", err)
+	}
+	want := "SELECT JSON_EXTRACT_SCALAR(payload,'$.forkee.id') id, " +
+		"JSON_EXTRACT_SCALAR(payload,'$.forkee.full_name') name, " +
+		"JSON_EXTRACT_SCALAR(payload,'$.forkee.owner.login') owner, " +
+		"JSON_EXTRACT_SCALAR(payload,'$.forkee.html_url') url, repo.url repo, " +
+		"created_at created FROM `githubarchive.day.20170701` " +
+		"WHERE type IN UNNEST(?) AND (repo.name IN UNNEST(?)) " +
+		"ORDER BY created DESC, id DESC LIMIT 10"
+	if got != want {
+		t.Errorf("ForkFetcher query:\nWant:\n %v\nGot:\n %v", want, got)
+	}
+}
+
+// TestActivityQuery checks the per repo counts of the activity query in both dialects
+func TestActivityQuery(t *testing.T) {
+	f := ActivityFetcher{Opts: Options{
+		Tables:       []bq.Table{{Name: "githubarchive.day.20170701"}},
+		Repositories: []string{"golang/go"},
+	}}
+	f.init()
+	testcases := []struct {
+		dialect bq.Dialect
+		want    string
+	}{
+		{bq.Standard, "SELECT repo.name repo, " +
+			"SUM(IF((type IN UNNEST(?) AND JSON_EXTRACT_SCALAR(payload,'$.action') = ?), 1, 0)) opened, " +
+			"SUM(IF((type IN UNNEST(?) AND JSON_EXTRACT_SCALAR(payload,'$.action') = ?), 1, 0)) closed, " +
+			"COUNT(DISTINCT IF(type IN UNNEST(?), actor.login, NULL)) commenters " +
+			"FROM `githubarchive.day.20170701` " +
+			"WHERE type IN UNNEST(?) AND (repo.name IN UNNEST(?)) GROUP BY repo.name"},
+		{bq.Legacy, "SELECT repo.name repo, " +
+			"SUM(IF((type IN ('IssuesEvent') AND " +
+			"JSON_EXTRACT_SCALAR(payload,'$.action') = 'opened'), 1, 0)) opened, " +
+			"SUM(IF((type IN ('IssuesEvent') AND " +
+			"JSON_EXTRACT_SCALAR(payload,'$.action') = 'closed'), 1, 0)) closed, " +
+			"COUNT(DISTINCT IF(type IN ('IssueCommentEvent'), actor.login, NULL)) commenters " +
+			"FROM [githubarchive.day.20170701] " +
+			"WHERE type IN ('IssuesEvent','IssueCommentEvent') AND (repo.name IN ('golang/go')) " +
+			"GROUP BY repo.name"},
+	}
+	for _, tc := range testcases {
+		got, err := f.query.Dialect(tc.dialect).SQL()
+		if err != nil {
+			t.Fatalf("ActivityFetcher query failed with error: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("ActivityFetcher query:\nWant:\n %v\nGot:\n %v", tc.want, got)
+		}
+	}
+}
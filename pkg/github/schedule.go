@@ -0,0 +1,354 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheduled digests are sent at the times of a cron style schedule with the fields minute,
+// hour, day of month, month and day of week, in the time zone of the user. A field is "*",
+// a value, a range "1-5", a list "9,17" or a step such as "*/2" or "8-18/2". Daily, weekly,
+// monthly, twice daily and hourly digests have schedules for the delivery hour of the user.
+// Digests cover the time since the previous time of the schedule.
+
+// ScheduleInterval is how often the mailer checks which scheduled digests are due
+const ScheduleInterval = 15 * time.Minute
+
+// maxScheduleSearch bounds the search for the times of a schedule, so that schedules
+// such as February 30th end the search
+const maxScheduleSearch = 4 * 366 * 24 * time.Hour
+
+// Digests are sent at 23:00 Pacific time to teams and to users that didn't choose a time
+const (
+	defaultTimezone     = "America/Los_Angeles"
+	defaultDeliveryHour = 23
+)
+
+// Delivery is when digests are sent, the time zone of their schedules, windows and
+// timestamps and the hour of the day that daily, weekly, monthly and twice daily digests
+// are sent at
+type Delivery struct {
+	Location *time.Location
+	Hour     int
+}
+
+// DefaultDelivery returns the delivery of digests at 23:00 Pacific time
+func DefaultDelivery() Delivery {
+	usLoc, _ := time.LoadLocation(defaultTimezone)
+	return Delivery{Location: usLoc, Hour: defaultDeliveryHour}
+}
+
+// Delivery returns when digests are sent to the user, with the default time zone if the
+// user's isn't valid
+func (u User) Delivery() Delivery {
+	d := DefaultDelivery()
+	if len(u.Timezone) != 0 {
+		if loc, err := time.LoadLocation(u.Timezone); err == nil {
+			d.Location = loc
+		}
+	}
+	if u.DeliveryHour >= 0 && u.DeliveryHour < 24 {
+		d.Hour = u.DeliveryHour
+	}
+	return d
+}
+
+// ValidTimezone returns an error unless name is an IANA time zone such as "Europe/Berlin"
+func ValidTimezone(name string) error {
+	if len(name) == 0 || name == "Local" {
+		return fmt.Errorf("Invalid time zone %q", name)
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("Invalid time zone %q: %v", name, err)
+	}
+	return nil
+}
+
+// Deliveries holds the Delivery of users by their ID
+type Deliveries map[uint64]Delivery
+
+// of returns the delivery of the digests of sub, which is the default for teams
+func (d Deliveries) of(sub Subscription) Delivery {
+	if delivery, ok := d[sub.UserID]; ok && sub.TeamID == 0 {
+		return delivery
+	}
+	return DefaultDelivery()
+}
+
+// frequencySchedule returns the schedule of digests with frequency f sent at hour, weekly
+// digests are sent on Fridays and monthly digests on the 1st
+func frequencySchedule(f Frequency, hour int) (string, bool) {
+	h := strconv.Itoa(hour)
+	switch f {
+	case Daily:
+		return "0 " + h + " * * *", true
+	case Weekly:
+		return "0 " + h + " * * 5", true
+	case Monthly:
+		return "0 " + h + " 1 * *", true
+	case TwiceDaily:
+		return "0 " + h + "," + strconv.Itoa((hour+12)%24) + " * * *", true
+	case Hourly:
+		return "0 * * * *", true
+	}
+	return "", false
+}
+
+// Schedule is a parsed cron style schedule
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+	anyDom, anyDow                bool   // day of month or week is "*"
+}
+
+// scheduleFields are the ranges of the fields of a schedule
+var scheduleFields = []struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// ParseSchedule parses a cron style schedule such as "0 9 * * 1-5"
+func ParseSchedule(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return Schedule{}, fmt.Errorf("Invalid schedule %q, expected 5 fields", expr)
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseScheduleField(field, scheduleFields[i].min, scheduleFields[i].max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("Invalid schedule %q: %v", expr, err)
+		}
+	}
+	return Schedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		anyDom: fields[2] == "*", anyDow: fields[4] == "*",
+	}, nil
+}
+
+// parseScheduleField returns the bit set of the values of a schedule field within min and max
+func parseScheduleField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step != 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// hasBit reports whether v is in the bit set bits
+func hasBit(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// matchDay reports whether the schedule has times on the day of t. Like cron, a day
+// matches either field when both day of month and day of week are restricted.
+func (s Schedule) matchDay(t time.Time) bool {
+	dom, dow := hasBit(s.dom, t.Day()), hasBit(s.dow, int(t.Weekday()))
+	if !s.anyDom && !s.anyDow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first time of the schedule after t, or the zero time if there is none
+func (s Schedule) Next(t time.Time) time.Time {
+	limit := t.Add(maxScheduleSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		if !hasBit(s.month, int(m)) {
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		} else if !s.matchDay(t) {
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		} else if !hasBit(s.hour, t.Hour()) {
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		} else if !hasBit(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Prev returns the last time of the schedule before t, or the zero time if there is none
+func (s Schedule) Prev(t time.Time) time.Time {
+	limit := t.Add(-maxScheduleSearch)
+	c := t.Truncate(time.Minute)
+	if !c.Before(t) {
+		c = c.Add(-time.Minute)
+	}
+	for c.After(limit) {
+		y, m, d := c.Date()
+		if !hasBit(s.month, int(m)) {
+			c = time.Date(y, m, 1, 0, 0, 0, 0, c.Location()).Add(-time.Minute)
+		} else if !s.matchDay(c) {
+			c = time.Date(y, m, d, 0, 0, 0, 0, c.Location()).Add(-time.Minute)
+		} else if !hasBit(s.hour, c.Hour()) {
+			c = time.Date(y, m, d, c.Hour(), 0, 0, 0, c.Location()).Add(-time.Minute)
+		} else if !hasBit(s.minute, c.Minute()) {
+			c = c.Add(-time.Minute)
+		} else {
+			return c
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduleTime returns the time that the scheduled cron job run at t checks digests
+// for, which is the start of its ScheduleInterval in Pacific time
+func ScheduleTime(t time.Time) time.Time {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	return t.In(usLoc).Truncate(ScheduleInterval)
+}
+
+// schedule returns the schedule of digests with frequency f for the subscription sent at hour
+func (s Subscription) schedule(f Frequency, hour int) (Schedule, error) {
+	if f == Scheduled {
+		return ParseSchedule(s.Schedule)
+	}
+	if expr, ok := frequencySchedule(f, hour); ok {
+		return ParseSchedule(expr)
+	}
+	return Schedule{}, fmt.Errorf("No schedule for frequency %d", f)
+}
+
+// DueWindow returns the window of the digest with frequency f for the subscription if
+// one is due for delivery d in the ScheduleInterval that ends at the ScheduleTime at. The
+// window starts at the last time of the schedule before that interval, so that schedules
+// with several times in one interval don't leave gaps.
+func (s Subscription) DueWindow(f Frequency, at time.Time, d Delivery) (Window, bool) {
+	if !s.EmailPreference.Has(f) {
+		return Window{}, false
+	}
+	sched, err := s.schedule(f, d.Hour)
+	if err != nil {
+		return Window{}, false
+	}
+	// Schedules are evaluated in the time zone of the delivery
+	at = at.In(d.Location)
+	end := sched.Prev(at.Add(time.Minute))
+	if end.IsZero() || !end.After(at.Add(-ScheduleInterval)) {
+		return Window{}, false
+	}
+	start := sched.Prev(at.Add(-ScheduleInterval).Add(time.Minute))
+	if start.IsZero() {
+		return Window{}, false
+	}
+	return Window{Start: start, End: end}, true
+}
+
+// PendingWindow returns the window of the next digest with frequency f for the
+// subscription so far at t for delivery d, which starts at the last time of the schedule
+// before t
+func (s Subscription) PendingWindow(f Frequency, t time.Time, d Delivery) (Window, bool) {
+	if !s.EmailPreference.Has(f) {
+		return Window{}, false
+	}
+	sched, err := s.schedule(f, d.Hour)
+	if err != nil {
+		return Window{}, false
+	}
+	t = t.In(d.Location)
+	start := sched.Prev(t)
+	if start.IsZero() {
+		return Window{}, false
+	}
+	return Window{Start: start, End: t}, true
+}
+
+// DueDigest is a window of activity that is due to be sent for subscriptions
+type DueDigest struct {
+	Window        Window
+	Subscriptions []Subscription
+}
+
+// DueDigests groups the subscriptions with a digest of frequency f due at the
+// ScheduleTime at for the deliveries of their users by the window of the digest
+func DueDigests(subscriptions []Subscription, f Frequency, at time.Time,
+	deliveries Deliveries) []DueDigest {
+
+	return groupDigests(subscriptions, func(sub Subscription) (Window, bool) {
+		return sub.DueWindow(f, at, deliveries.of(sub))
+	})
+}
+
+// PendingDigests groups the subscriptions with a digest of frequency f by the
+// PendingWindow of the digest at t for the deliveries of their users, such as for a preview
+// of the digests that they would get
+func PendingDigests(subscriptions []Subscription, f Frequency, t time.Time,
+	deliveries Deliveries) []DueDigest {
+
+	return groupDigests(subscriptions, func(sub Subscription) (Window, bool) {
+		return sub.PendingWindow(f, t, deliveries.of(sub))
+	})
+}
+
+// groupDigests groups the subscriptions by the window of their digest, leaving out the
+// ones without one
+func groupDigests(subscriptions []Subscription,
+	window func(Subscription) (Window, bool)) []DueDigest {
+
+	digests := []DueDigest{}
+	for _, sub := range subscriptions {
+		w, ok := window(sub)
+		if !ok {
+			continue
+		}
+		found := false
+		for i := range digests {
+			if digests[i].Window.Start.Equal(w.Start) && digests[i].Window.End.Equal(w.End) {
+				digests[i].Subscriptions = append(digests[i].Subscriptions, sub)
+				found = true
+				break
+			}
+		}
+		if !found {
+			digests = append(digests, DueDigest{Window: w, Subscriptions: []Subscription{sub}})
+		}
+	}
+	return digests
+}
@@ -0,0 +1,165 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	testCases := []struct {
+		expr  string
+		valid bool
+	}{
+		{"0 * * * *", true},
+		{"0 9 * * 1-5", true},
+		{"*/15 8-18/2 1,15 * *", true},
+		{"0 9 * *", false},
+		{"60 * * * *", false},
+		{"0 9 * * 7", false},
+		{"0 9-8 * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+	}
+	for _, tc := range testCases {
+		if _, err := ParseSchedule(tc.expr); (err == nil) != tc.valid {
+			t.Errorf("ParseSchedule(%q) got error %v, wanted valid %v", tc.expr, err, tc.valid)
+		}
+	}
+}
+
+func TestScheduleNextPrev(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2017, 8, 11, 10, 30, 0, 0, usLoc) // a Friday
+	testCases := []struct {
+		expr string
+		prev time.Time
+		next time.Time
+	}{
+		{"0 * * * *", time.Date(2017, 8, 11, 10, 0, 0, 0, usLoc),
+			time.Date(2017, 8, 11, 11, 0, 0, 0, usLoc)},
+		{"0 11,23 * * *", time.Date(2017, 8, 10, 23, 0, 0, 0, usLoc),
+			time.Date(2017, 8, 11, 11, 0, 0, 0, usLoc)},
+		{"30 9 * * 1", time.Date(2017, 8, 7, 9, 30, 0, 0, usLoc),
+			time.Date(2017, 8, 14, 9, 30, 0, 0, usLoc)},
+		{"30 10 * * *", time.Date(2017, 8, 10, 10, 30, 0, 0, usLoc),
+			time.Date(2017, 8, 12, 10, 30, 0, 0, usLoc)},
+		{"0 0 1 1 *", time.Date(2017, 1, 1, 0, 0, 0, 0, usLoc),
+			time.Date(2018, 1, 1, 0, 0, 0, 0, usLoc)},
+	}
+	for _, tc := range testCases {
+		s, err := ParseSchedule(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) failed: %v", tc.expr, err)
+		}
+		if got := s.Prev(at); !got.Equal(tc.prev) {
+			t.Errorf("Prev(%q) got %v, wanted %v", tc.expr, got, tc.prev)
+		}
+		if got := s.Next(at); !got.Equal(tc.next) {
+			t.Errorf("Next(%q) got %v, wanted %v", tc.expr, got, tc.next)
+		}
+	}
+	if s, _ := ParseSchedule("0 0 30 2 *"); !s.Next(at).IsZero() {
+		t.Errorf("Next() got %v for February 30th, wanted no time", s.Next(at))
+	}
+}
+
+func TestDueDigests(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	hour := time.Date(2017, 8, 11, 11, 0, 0, 0, usLoc)
+	subs := []Subscription{
+		{ID: 1, EmailPreference: EmailPreference{IssueOpen: Hourly}},
+		{ID: 2, EmailPreference: EmailPreference{NewComment: Hourly}},
+		{ID: 3, EmailPreference: EmailPreference{IssueOpen: Daily}},
+		{ID: 4, EmailPreference: EmailPreference{IssueOpen: Scheduled}, Schedule: "*/5 * * * *"},
+		{ID: 5, EmailPreference: EmailPreference{IssueOpen: Scheduled}, Schedule: "invalid"},
+	}
+	digests := DueDigests(subs, Hourly, hour, nil)
+	if len(digests) != 1 || len(digests[0].Subscriptions) != 2 {
+		t.Fatalf("DueDigests(Hourly) got %v, wanted subscriptions 1 and 2", digests)
+	}
+	want := Window{Start: hour.Add(-time.Hour), End: hour}
+	if w := digests[0].Window; !w.Start.Equal(want.Start) || !w.End.Equal(want.End) {
+		t.Errorf("DueDigests(Hourly) got window %v, wanted %v", w, want)
+	}
+	if digests := DueDigests(subs, Hourly, hour.Add(ScheduleInterval), nil); len(digests) != 0 {
+		t.Errorf("DueDigests(Hourly) got %v in the next interval, wanted none", digests)
+	}
+	// Schedules with several times in an interval cover all of them
+	digests = DueDigests(subs, Scheduled, hour, nil)
+	if len(digests) != 1 || digests[0].Subscriptions[0].ID != 4 {
+		t.Fatalf("DueDigests(Scheduled) got %v, wanted subscription 4", digests)
+	}
+	want = Window{Start: hour.Add(-ScheduleInterval), End: hour}
+	if w := digests[0].Window; !w.Start.Equal(want.Start) || !w.End.Equal(want.End) {
+		t.Errorf("DueDigests(Scheduled) got window %v, wanted %v", w, want)
+	}
+}
+
+func TestDueDigestsDelivery(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	user := User{ID: 1, Timezone: "Europe/Berlin", DeliveryHour: 9}
+	subs := []Subscription{
+		{ID: 1, UserID: 1, EmailPreference: EmailPreference{IssueOpen: Daily}},
+		{ID: 2, UserID: 2, EmailPreference: EmailPreference{IssueOpen: Daily}},
+		{ID: 3, UserID: 1, TeamID: 1, EmailPreference: EmailPreference{IssueOpen: Daily}},
+	}
+	deliveries := Deliveries{user.ID: user.Delivery()}
+	at := time.Date(2017, 8, 11, 9, 0, 0, 0, berlin)
+	digests := DueDigests(subs, Daily, at, deliveries)
+	if len(digests) != 1 || len(digests[0].Subscriptions) != 1 || digests[0].Subscriptions[0].ID != 1 {
+		t.Fatalf("DueDigests(Daily) got %v at 9:00 in Berlin, wanted subscription 1", digests)
+	}
+	w := digests[0].Window
+	if !w.Start.Equal(at.AddDate(0, 0, -1)) || !w.End.Equal(at) || w.End.Location().String() != "Europe/Berlin" {
+		t.Errorf("DueDigests(Daily) got window %v, wanted the day to %v in Berlin", w, at)
+	}
+	// Others get digests at 23:00 Pacific time
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	at = time.Date(2017, 8, 11, 23, 0, 0, 0, usLoc)
+	digests = DueDigests(subs, Daily, at, deliveries)
+	if len(digests) != 1 || len(digests[0].Subscriptions) != 2 {
+		t.Errorf("DueDigests(Daily) got %v at 23:00 Pacific, wanted subscriptions 2 and 3", digests)
+	}
+	d := User{Timezone: "Nowhere/City", DeliveryHour: 7}.Delivery()
+	if d.Location.String() != "America/Los_Angeles" || d.Hour != 7 {
+		t.Errorf("Delivery() got %v for an invalid time zone, wanted Pacific time", d)
+	}
+}
+
+func TestPendingDigests(t *testing.T) {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	now := time.Date(2017, 8, 11, 11, 20, 0, 0, usLoc)
+	subs := []Subscription{
+		{ID: 1, EmailPreference: EmailPreference{IssueOpen: Daily}},
+		{ID: 2, EmailPreference: EmailPreference{IssueOpen: Weekly}},
+		{ID: 3, EmailPreference: EmailPreference{IssueOpen: Scheduled}, Schedule: "0 * * * *"},
+	}
+	digests := PendingDigests(subs, Daily, now, nil)
+	if len(digests) != 1 || digests[0].Subscriptions[0].ID != 1 {
+		t.Fatalf("PendingDigests(Daily) got %v, wanted subscription 1", digests)
+	}
+	// Daily digests are sent at 23:00 by default, the pending one started yesterday
+	want := Window{Start: time.Date(2017, 8, 10, 23, 0, 0, 0, usLoc), End: now}
+	if w := digests[0].Window; !w.Start.Equal(want.Start) || !w.End.Equal(want.End) {
+		t.Errorf("PendingDigests(Daily) got window %v, wanted %v", w, want)
+	}
+	digests = PendingDigests(subs, Scheduled, now, nil)
+	want = Window{Start: time.Date(2017, 8, 11, 11, 0, 0, 0, usLoc), End: now}
+	if len(digests) != 1 || !digests[0].Window.Start.Equal(want.Start) {
+		t.Errorf("PendingDigests(Scheduled) got %v, wanted window %v", digests, want)
+	}
+}
@@ -0,0 +1,647 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github/bq"
+
+	"golang.org/x/net/context"
+)
+
+// EventSource provides the GitHub activity that digests are composed from
+type EventSource interface {
+	// Issues returns issues from repos with an event of the given action such as
+	// "opened", "closed" or "reopened" within w, at most limit issues if limit is set
+	Issues(ctx context.Context, repos []string, action string, w Window, limit uint64) ([]Issue, error)
+	// Comments returns new comments on open issues of repos within w, at most limit
+	// comments if limit is set
+	Comments(ctx context.Context, repos []string, w Window, limit uint64) ([]Comment, error)
+	// PullRequests returns pull requests from repos with an event of the given action such
+	// as "opened", "merged", "closed" or "review_requested" within w, at most limit pull
+	// requests if limit is set
+	PullRequests(ctx context.Context,
+		repos []string, action string, w Window, limit uint64) ([]PullRequest, error)
+	// Reviews returns reviews submitted within w on pull requests of repos, or review
+	// comments created within w for the kind "review_comment", at most limit reviews if
+	// limit is set
+	Reviews(ctx context.Context,
+		repos []string, kind string, w Window, limit uint64) ([]Review, error)
+	// Releases returns releases of repos published within w, at most limit releases if
+	// limit is set
+	Releases(ctx context.Context, repos []string, w Window, limit uint64) ([]Release, error)
+	// Forks returns forks of repos created within w, at most limit forks if limit is set
+	Forks(ctx context.Context, repos []string, w Window, limit uint64) ([]Fork, error)
+	// Stars returns the number of stars given to each of repos within w by repo name
+	Stars(ctx context.Context, repos []string, w Window) (map[string]int, error)
+}
+
+// Names of event sources that can be set globally with NewSource or for a Subscription
+const (
+	SourceBigQuery = "bigquery" // githubarchive on BigQuery
+	SourceGitHub   = "github"   // GitHub API
+	SourceStore    = "store"    // issues and comments received by webhooks
+)
+
+// NewSource returns the EventSource with the given name, BigQuery is used by default
+func NewSource(name string) EventSource {
+	if name == SourceGitHub {
+		return APISource{}
+	} else if name == SourceStore {
+		return StoreSource{}
+	}
+	return BigQuerySource{}
+}
+
+// ValidSource returns true if name is the name of an event source or empty for the default
+func ValidSource(name string) bool {
+	return name == "" || name == SourceBigQuery || name == SourceGitHub || name == SourceStore
+}
+
+// repoSource is an EventSource that gets events for repos from the source set for them
+// by subscriptions and from a default source for all other repos
+type repoSource struct {
+	fallback EventSource
+	repos    map[string]string // source name for each repo
+}
+
+// withSubscriptionSources returns source, or a repoSource if any subscription sets its own
+func withSubscriptionSources(source EventSource, subscriptions []Subscription) EventSource {
+	repos := map[string]string{}
+	for _, sub := range subscriptions {
+		if len(sub.Source) != 0 && len(repos[sub.Repo]) == 0 {
+			repos[sub.Repo] = sub.Source
+		}
+	}
+	if len(repos) == 0 {
+		return source
+	}
+	return repoSource{fallback: source, repos: repos}
+}
+
+// split groups repos by the source to get their events from
+func (s repoSource) split(repos []string) map[EventSource][]string {
+	sources := map[EventSource][]string{}
+	for _, repo := range repos {
+		source := s.fallback
+		if name, ok := s.repos[repo]; ok {
+			source = NewSource(name)
+		}
+		sources[source] = append(sources[source], repo)
+	}
+	return sources
+}
+
+// Issues gets issues from the source of each repo
+func (s repoSource) Issues(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
+
+	var errors error
+	issues := []Issue{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Issues(ctx, sourceRepos, action, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		issues = append(issues, results...)
+	}
+	return issues, errors
+}
+
+// Comments gets comments from the source of each repo
+func (s repoSource) Comments(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+
+	var errors error
+	comments := []Comment{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Comments(ctx, sourceRepos, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		comments = append(comments, results...)
+	}
+	return comments, errors
+}
+
+// PullRequests gets pull requests from the source of each repo
+func (s repoSource) PullRequests(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+
+	var errors error
+	pulls := []PullRequest{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.PullRequests(ctx, sourceRepos, action, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		pulls = append(pulls, results...)
+	}
+	return pulls, errors
+}
+
+// Reviews gets reviews from the source of each repo
+func (s repoSource) Reviews(ctx context.Context,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+
+	var errors error
+	reviews := []Review{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Reviews(ctx, sourceRepos, kind, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		reviews = append(reviews, results...)
+	}
+	return reviews, errors
+}
+
+// Releases gets releases from the source of each repo
+func (s repoSource) Releases(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Release, error) {
+
+	var errors error
+	releases := []Release{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Releases(ctx, sourceRepos, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		releases = append(releases, results...)
+	}
+	return releases, errors
+}
+
+// Forks gets forks from the source of each repo
+func (s repoSource) Forks(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+
+	var errors error
+	forks := []Fork{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Forks(ctx, sourceRepos, w, limit)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		forks = append(forks, results...)
+	}
+	return forks, errors
+}
+
+// Stars gets the number of stars from the source of each repo
+func (s repoSource) Stars(ctx context.Context,
+	repos []string, w Window) (map[string]int, error) {
+
+	var errors error
+	stars := map[string]int{}
+	for source, sourceRepos := range s.split(repos) {
+		results, err := source.Stars(ctx, sourceRepos, w)
+		if err != nil {
+			errors = joinErrors(errors, fmt.Errorf("%T: %v", source, err))
+			continue
+		}
+		for repo, count := range results {
+			stars[repo] = count
+		}
+	}
+	return stars, errors
+}
+
+// joinErrors returns err added to errors
+func joinErrors(errors error, err error) error {
+	if errors == nil {
+		return err
+	}
+	return fmt.Errorf("%v\n%v", errors, err)
+}
+
+// Window is the period of time that a digest covers
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// NewWindow returns the window covered by a digest of frequency f sent at t. Like the
+// githubarchive tables that digests were first built from, windows are calendar periods in
+// Pacific time: daily digests cover the day of t, weekly digests the 7 days up to the end
+// of the day of t and monthly digests the month of t. Immediate notifications cover the
+// last complete ImmediateInterval, so that consecutive runs neither overlap nor leave gaps.
+func NewWindow(f Frequency, t time.Time) Window {
+	usLoc, _ := time.LoadLocation("America/Los_Angeles")
+	t = t.In(usLoc)
+	if f == Immediate {
+		end := t.Truncate(ImmediateInterval)
+		return Window{Start: end.Add(-ImmediateInterval), End: end}
+	}
+	y, m, d := t.Date()
+	if f == Weekly {
+		return Window{
+			Start: time.Date(y, m, d-6, 0, 0, 0, 0, usLoc),
+			End:   time.Date(y, m, d+1, 0, 0, 0, 0, usLoc),
+		}
+	} else if f == Monthly {
+		return Window{
+			Start: time.Date(y, m, 1, 0, 0, 0, 0, usLoc),
+			End:   time.Date(y, m+1, 1, 0, 0, 0, 0, usLoc),
+		}
+	}
+	return Window{
+		Start: time.Date(y, m, d, 0, 0, 0, 0, usLoc),
+		End:   time.Date(y, m, d+1, 0, 0, 0, 0, usLoc),
+	}
+}
+
+// archiveLag is how far githubarchive is behind, as its hourly tables are loaded after
+// the end of the hour
+const archiveLag = 2 * time.Hour
+
+// sourceLag returns how far the activity of source is behind, which is the largest lag of
+// the sources of a repoSource
+func sourceLag(source EventSource) time.Duration {
+	switch s := source.(type) {
+	case BigQuerySource:
+		return archiveLag
+	case repoSource:
+		lag := sourceLag(s.fallback)
+		for _, name := range s.repos {
+			if l := sourceLag(NewSource(name)); l > lag {
+				lag = l
+			}
+		}
+		return lag
+	}
+	return 0
+}
+
+// Horizon returns the time up to which source, and the sources set by subscriptions, have
+// all the activity at t
+func Horizon(source EventSource, subscriptions []Subscription, t time.Time) time.Time {
+	return t.Add(-sourceLag(withSubscriptionSources(source, subscriptions)))
+}
+
+// DigestWindow returns the window of the digest of frequency f for subscriptions sent at t
+// with activity from source. Immediate notifications cover the last complete
+// ImmediateInterval before the Horizon, and other windows end at the Horizon at the latest,
+// so that activity that a source has yet to load is left for the next digest.
+func DigestWindow(source EventSource, subscriptions []Subscription, f Frequency,
+	t time.Time) Window {
+
+	horizon := Horizon(source, subscriptions, t)
+	if f == Immediate {
+		return NewWindow(f, horizon)
+	}
+	return NewWindow(f, t).until(horizon)
+}
+
+// Loaded returns w ending at the Horizon of source and subscriptions at the end of w, for
+// windows that end when their digest is sent such as the ones returned by DueDigests
+func (w Window) Loaded(source EventSource, subscriptions []Subscription) Window {
+	return w.until(Horizon(source, subscriptions, w.End))
+}
+
+// until returns w ending at t if it ends later
+func (w Window) until(t time.Time) Window {
+	if w.End.After(t) {
+		w.End = t.In(w.End.Location())
+	}
+	if w.Start.After(w.End) {
+		w.Start = w.End
+	}
+	return w
+}
+
+// condition limits githubarchive events to the ones created within w
+func (w Window) condition() bq.Condition {
+	return bq.Expr("created_at >= ? AND created_at < ?", w.Start, w.End)
+}
+
+// BigQuerySource is an EventSource for the githubarchive dataset on BigQuery
+type BigQuerySource struct{}
+
+// Issues queries githubarchive with an IssueFetcher
+func (BigQuerySource) Issues(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
+
+	o := Options{
+		Repositories: repos,
+		Conditions: []bq.Condition{
+			bq.In("type", "IssuesEvent"),
+			repoCondition(repos),
+			bq.In(bq.JExtract("payload", "action"), action),
+			w.condition(),
+		},
+		Limit: limit,
+	}
+	o.SetWindow(w)
+	return fetchIssues(ctx, o)
+}
+
+// Comments queries githubarchive with a CommentFetcher
+func (BigQuerySource) Comments(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+
+	o := Options{
+		Repositories: repos,
+		Conditions: []bq.Condition{
+			bq.In("type", "IssueCommentEvent"),
+			repoCondition(repos),
+			bq.In(bq.JExtract("payload", "issue.state"), "open"),
+			bq.In(bq.JExtract("payload", "action"), "created"),
+			w.condition(),
+		},
+		Limit: limit,
+	}
+	o.SetWindow(w)
+	return fetchComments(ctx, o)
+}
+
+// PullRequests queries githubarchive with a PullRequestFetcher. Merged and closed pull
+// requests both have the action "closed" in githubarchive and are told apart by
+// pull_request.merged.
+func (BigQuerySource) PullRequests(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+
+	conditions := []bq.Condition{
+		bq.In("type", "PullRequestEvent"),
+		repoCondition(repos),
+	}
+	merged := bq.JExtract("payload", "pull_request.merged")
+	switch action {
+	case "merged":
+		conditions = append(conditions, bq.In(bq.JExtract("payload", "action"), "closed"),
+			bq.Expr(merged+" = ?", "true"))
+	case "closed":
+		conditions = append(conditions, bq.In(bq.JExtract("payload", "action"), "closed"),
+			bq.Expr(merged+" = ?", "false"))
+	default:
+		conditions = append(conditions, bq.In(bq.JExtract("payload", "action"), action))
+	}
+	o := Options{
+		Repositories: repos,
+		Conditions:   append(conditions, w.condition()),
+		Limit:        limit,
+	}
+	o.SetWindow(w)
+	return fetchPullRequests(ctx, o)
+}
+
+// Reviews queries githubarchive with a ReviewFetcher
+func (BigQuerySource) Reviews(ctx context.Context,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+
+	event := "PullRequestReviewEvent"
+	if kind == "review_comment" {
+		event = "PullRequestReviewCommentEvent"
+	}
+	o := Options{
+		Repositories: repos,
+		Kind:         []string{kind},
+		Conditions: []bq.Condition{
+			bq.In("type", event),
+			repoCondition(repos),
+			w.condition(),
+		},
+		Limit: limit,
+	}
+	o.SetWindow(w)
+	return fetchReviews(ctx, o)
+}
+
+// Releases queries githubarchive with a ReleaseFetcher
+func (BigQuerySource) Releases(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Release, error) {
+
+	if len(repos) == 0 {
+		return []Release{}, nil
+	}
+	o := Options{
+		Repositories: repos,
+		Conditions: []bq.Condition{
+			bq.In("type", "ReleaseEvent"),
+			repoCondition(repos),
+			bq.In(bq.JExtract("payload", "action"), "published"),
+			w.condition(),
+		},
+		Limit: limit,
+	}
+	o.SetWindow(w)
+	fetcher := ReleaseFetcher{Opts: o}
+	return fetcher.Fetch(ctx)
+}
+
+// Forks queries githubarchive with a ForkFetcher
+func (BigQuerySource) Forks(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+
+	if len(repos) == 0 {
+		return []Fork{}, nil
+	}
+	o := Options{
+		Repositories: repos,
+		Conditions: []bq.Condition{
+			bq.In("type", "ForkEvent"),
+			repoCondition(repos),
+			w.condition(),
+		},
+		Limit: limit,
+	}
+	o.SetWindow(w)
+	fetcher := ForkFetcher{Opts: o}
+	return fetcher.Fetch(ctx)
+}
+
+// Stars queries githubarchive with a StarFetcher
+func (BigQuerySource) Stars(ctx context.Context,
+	repos []string, w Window) (map[string]int, error) {
+
+	if len(repos) == 0 {
+		return map[string]int{}, nil
+	}
+	o := Options{
+		Repositories: repos,
+		Conditions: []bq.Condition{
+			bq.In("type", "WatchEvent"),
+			repoCondition(repos),
+			w.condition(),
+		},
+	}
+	o.SetWindow(w)
+	fetcher := StarFetcher{Opts: o}
+	return fetcher.Fetch(ctx)
+}
+
+// StoreSource is an EventSource for the activity stored from webhooks by
+// SaveWebhook. Comments on closed issues are included as their state isn't stored.
+type StoreSource struct{}
+
+// Issues returns stored issues created within w for "opened", or stored issues that
+// were last closed or reopened within w
+func (StoreSource) Issues(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]Issue, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get issues, invalid DB Connection")
+	}
+	issues := []Issue{}
+	query := whereRepos(repos).Where("pull_request = ? OR pull_request IS NULL", false)
+	if action == "opened" {
+		query = query.Where("created >= ? AND created < ?", w.Start, w.End)
+	} else {
+		query = query.Where("action = ? AND updated_at >= ? AND updated_at < ?",
+			action, w.Start, w.End)
+	}
+	limit = (&Options{Limit: limit}).getLimits()
+	if err := query.Order("id desc").Limit(limit).Find(&issues).Error; err != nil {
+		return nil, err
+	}
+	if action != "opened" {
+		// issues are created at the time of the event like in githubarchive
+		for i := range issues {
+			issues[i].Created = issues[i].UpdatedAt
+		}
+	}
+	return issues, nil
+}
+
+// Comments returns stored comments created within w
+func (StoreSource) Comments(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Comment, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get comments, invalid DB Connection")
+	}
+	comments := []Comment{}
+	limit = (&Options{Limit: limit}).getLimits()
+	err := whereRepos(repos).Where("created >= ? AND created < ?", w.Start, w.End).
+		Order("id desc").Limit(limit).Find(&comments).Error
+	return comments, err
+}
+
+// PullRequests returns stored pull requests created within w for "opened", or stored
+// pull requests whose last action was within w
+func (StoreSource) PullRequests(ctx context.Context,
+	repos []string, action string, w Window, limit uint64) ([]PullRequest, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get pull requests, invalid DB Connection")
+	}
+	pulls := []PullRequest{}
+	query := whereRepos(repos)
+	if action == "opened" {
+		query = query.Where("created >= ? AND created < ?", w.Start, w.End)
+	} else {
+		query = query.Where("action = ? AND updated_at >= ? AND updated_at < ?",
+			action, w.Start, w.End)
+	}
+	limit = (&Options{Limit: limit}).getLimits()
+	if err := query.Order("id desc").Limit(limit).Find(&pulls).Error; err != nil {
+		return nil, err
+	}
+	for i := range pulls {
+		if action == "opened" {
+			// the last action is kept for pull requests that were opened within w
+			pulls[i].Action = action
+		} else {
+			pulls[i].Created = pulls[i].UpdatedAt
+		}
+	}
+	return pulls, nil
+}
+
+// Reviews returns stored reviews or review comments created within w
+func (StoreSource) Reviews(ctx context.Context,
+	repos []string, kind string, w Window, limit uint64) ([]Review, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get reviews, invalid DB Connection")
+	}
+	reviews := []Review{}
+	limit = (&Options{Limit: limit}).getLimits()
+	err := whereRepos(repos).Where("comment = ? AND created >= ? AND created < ?",
+		kind == "review_comment", w.Start, w.End).
+		Order("id desc").Limit(limit).Find(&reviews).Error
+	return reviews, err
+}
+
+// Releases returns stored releases published within w
+func (StoreSource) Releases(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Release, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get releases, invalid DB Connection")
+	}
+	releases := []Release{}
+	limit = (&Options{Limit: limit}).getLimits()
+	err := whereRepos(repos).Where("created >= ? AND created < ?", w.Start, w.End).
+		Order("created desc").Limit(limit).Find(&releases).Error
+	return releases, err
+}
+
+// Forks returns stored forks created within w
+func (StoreSource) Forks(ctx context.Context,
+	repos []string, w Window, limit uint64) ([]Fork, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get forks, invalid DB Connection")
+	}
+	forks := []Fork{}
+	limit = (&Options{Limit: limit}).getLimits()
+	err := whereRepos(repos).Where("created >= ? AND created < ?", w.Start, w.End).
+		Order("created desc").Limit(limit).Find(&forks).Error
+	return forks, err
+}
+
+// Stars counts stored stars given within w
+func (StoreSource) Stars(ctx context.Context,
+	repos []string, w Window) (map[string]int, error) {
+
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get stars, invalid DB Connection")
+	}
+	stars := map[string]int{}
+	rows, err := whereRepos(repos).Model(&Star{}).Select("repo, count(*)").
+		Where("created >= ? AND created < ?", w.Start, w.End).
+		Group("repo").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var repo string
+		var count int
+		if err := rows.Scan(&repo, &count); err != nil {
+			return nil, err
+		}
+		stars[repoFromURL(repo)] = count
+	}
+	return stars, rows.Err()
+}
+
+// repoURLs returns the API urls that issues and comments store for repos
+func repoURLs(repos []string) []string {
+	urls := make([]string, len(repos))
+	for i, repo := range repos {
+		urls[i] = endpoint + repoAPI + repo
+	}
+	return urls
+}
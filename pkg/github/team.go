@@ -0,0 +1,353 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"time"
+)
+
+// Team shares a set of subscriptions between its members, who get one team digest
+// instead of a digest each for the same repos
+type Team struct {
+	ID            uint           `gorm:"primary_key;AUTO_INCREMENT"`
+	Name          string         `gorm:"unique_index;not null;"`
+	Email         string         // mailing list for the team digest, empty to email each member
+	Members       []TeamMember   `gorm:"ForeignKey:TeamID"`
+	Subscriptions []Subscription `gorm:"ForeignKey:TeamID"`
+	CreatedAt     time.Time
+}
+
+// TeamMember relates a user with a team. Owners can change the team, its members and
+// its subscriptions.
+type TeamMember struct {
+	TeamID uint   `gorm:"primary_key;auto_increment:false"`
+	UserID uint64 `gorm:"primary_key;auto_increment:false"`
+	Owner  bool
+	User   User `gorm:"ForeignKey:UserID"`
+}
+
+// CreateTeam adds a team with owner as its first member
+func CreateTeam(name string, email string, owner User) (Team, error) {
+	if DB == nil {
+		return Team{}, fmt.Errorf("Failed to create team, invalid DB Connection")
+	}
+	if len(name) == 0 {
+		return Team{}, fmt.Errorf("Failed to create team, no name")
+	}
+	if DB.First(&Team{}, "name = ?", name).RecordNotFound() == false {
+		return Team{}, fmt.Errorf("Failed to create team, %s already exists", name)
+	}
+	team := Team{
+		Name:    name,
+		Email:   email,
+		Members: []TeamMember{{UserID: owner.ID, Owner: true}},
+	}
+	if err := DB.Create(&team).Error; err != nil {
+		return Team{}, err
+	}
+	return team, nil
+}
+
+// FindTeam retrieves a team with its members and subscriptions
+func FindTeam(id uint) (Team, error) {
+	var team Team
+	if DB == nil {
+		return team, fmt.Errorf("Failed to find team, invalid DB Connection")
+	}
+	err := DB.Preload("Members").Preload("Members.User").
+		Preload("Subscriptions").Preload("Subscriptions.EmailPreference").
+		Preload("Subscriptions.Filter").First(&team, "id = ?", id).Error
+	return team, err
+}
+
+// GetTeams returns all teams
+func GetTeams() ([]Team, error) {
+	var teams []Team
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get teams, invalid DB Connection")
+	}
+	if err := DB.Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// GetTeams returns the teams that the user is a member of
+func (u User) GetTeams() ([]Team, error) {
+	teams := []Team{}
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get teams, invalid DB Connection")
+	}
+	err := DB.Preload("Members").Preload("Members.User").
+		Preload("Subscriptions").Preload("Subscriptions.EmailPreference").
+		Preload("Subscriptions.Filter").
+		Joins("JOIN team_members ON team_members.team_id = teams.id").
+		Where("team_members.user_id = ?", u.ID).Find(&teams).Error
+	return teams, err
+}
+
+// member returns the membership of the user with userID
+func (t Team) member(userID uint64) (TeamMember, bool) {
+	for _, m := range t.Members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+	return TeamMember{}, false
+}
+
+// IsMember reports whether the user is a member of the team
+func (t Team) IsMember(u User) bool {
+	_, ok := t.member(u.ID)
+	return ok
+}
+
+// IsOwner reports whether the user is an owner of the team
+func (t Team) IsOwner(u User) bool {
+	m, ok := t.member(u.ID)
+	return ok && m.Owner
+}
+
+// Recipients returns the addresses that the team digest is sent to
+func (t Team) Recipients() []string {
+	if len(t.Email) != 0 {
+		return []string{t.Email}
+	}
+	emails := []string{}
+	for _, m := range t.Members {
+		if len(m.User.Email) != 0 {
+			emails = append(emails, m.User.Email)
+		}
+	}
+	return emails
+}
+
+// Update saves the name and email of the team
+func (t *Team) Update() error {
+	if DB == nil {
+		return fmt.Errorf("Failed to update team, invalid DB Connection")
+	}
+	return DB.Model(t).Updates(map[string]interface{}{"name": t.Name, "email": t.Email}).Error
+}
+
+// Remove deletes the team along with its members and subscriptions
+func (t Team) Remove() error {
+	if DB == nil {
+		return fmt.Errorf("Failed to remove team, invalid DB Connection")
+	}
+	if err := DB.Where("team_id = ?", t.ID).Delete(Subscription{}).Error; err != nil {
+		return err
+	}
+	return DB.Delete(&t).Error
+}
+
+// AddMember adds the user to the team, or changes whether an existing member is an owner
+func (t *Team) AddMember(u User, owner bool) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to add member, invalid DB Connection")
+	}
+	m := TeamMember{TeamID: t.ID, UserID: u.ID, Owner: owner}
+	if err := DB.Save(&m).Error; err != nil {
+		return err
+	}
+	m.User = u
+	for i := range t.Members {
+		if t.Members[i].UserID == u.ID {
+			t.Members[i] = m
+			return nil
+		}
+	}
+	t.Members = append(t.Members, m)
+	return nil
+}
+
+// LastOwner reports whether the user is the only owner of the team, who can't leave it
+func (t Team) LastOwner(u User) bool {
+	owners := 0
+	for _, m := range t.Members {
+		if m.Owner {
+			owners++
+		}
+	}
+	return t.IsOwner(u) && owners == 1
+}
+
+// RemoveMember removes the user from the team, unless the user is its last owner
+func (t *Team) RemoveMember(u User) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to remove member, invalid DB Connection")
+	}
+	if t.LastOwner(u) {
+		return fmt.Errorf("Failed to remove member, %s is the last owner", u.Login)
+	}
+	if _, err := t.handOver(u.ID); err != nil {
+		return err
+	}
+	if err := DB.Delete(&TeamMember{}, "team_id = ? AND user_id = ?", t.ID, u.ID).Error; err != nil {
+		return err
+	}
+	members := []TeamMember{}
+	for _, m := range t.Members {
+		if m.UserID != u.ID {
+			members = append(members, m)
+		}
+	}
+	t.Members = members
+	return nil
+}
+
+// successor returns the member that takes over the subscriptions added by the user with
+// userID when the user leaves, preferring owners. ok is false if the user is the only member.
+func (t Team) successor(userID uint64) (m TeamMember, ok bool) {
+	for _, member := range t.Members {
+		if member.UserID == userID {
+			continue
+		}
+		if member.Owner {
+			return member, true
+		}
+		if !ok {
+			m, ok = member, true
+		}
+	}
+	return m, ok
+}
+
+// handOver moves the subscriptions of the team that the user with userID added to the
+// successor of the user, who becomes an owner if needed. Subscriptions belong to the user
+// that added them, and are deleted with the user, so they are handed over before the user
+// leaves the team or is removed. It reports false if nobody is left to take them over.
+func (t *Team) handOver(userID uint64) (bool, error) {
+	if DB == nil {
+		return false, fmt.Errorf("Failed to hand over subscriptions, invalid DB Connection")
+	}
+	next, ok := t.successor(userID)
+	if !ok {
+		return false, nil
+	}
+	tx := DB.Begin()
+	if !next.Owner {
+		err := tx.Model(&TeamMember{}).Where("team_id = ? AND user_id = ?", t.ID, next.UserID).
+			Update("owner", true).Error
+		if err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("Failed to hand over subscriptions, DB Error: %v", err)
+		}
+	}
+	err := tx.Model(&Subscription{}).Where("team_id = ? AND user_id = ?", t.ID, userID).
+		Update("user_id", next.UserID).Error
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("Failed to hand over subscriptions, DB Error: %v", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	for i := range t.Members {
+		if t.Members[i].UserID == next.UserID {
+			t.Members[i].Owner = true
+		}
+	}
+	for i := range t.Subscriptions {
+		if t.Subscriptions[i].UserID == userID {
+			t.Subscriptions[i].UserID = next.UserID
+		}
+	}
+	return true, nil
+}
+
+// GetSubscriptions returns the subscriptions of the team that match passed repos
+// If no repos are passed, it returns the entire list of subscriptions
+func (t Team) GetSubscriptions(repos ...string) ([]Subscription, error) {
+	results := []Subscription{}
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get subscriptions, invalid DB Connection")
+	}
+	query := DB.Preload("EmailPreference").Preload("Filter").Where("team_id = ?", t.ID)
+	if len(repos) == 0 {
+		err := query.Find(&results).Error
+		return results, err
+	}
+	for _, repo := range repos {
+		var sub Subscription
+		if query.Where("repo = ?", repo).First(&sub).RecordNotFound() {
+			return nil, fmt.Errorf("No such subscription: %s", repo)
+		}
+		results = append(results, sub)
+	}
+	return results, nil
+}
+
+// Subscribe adds a subscription to the team. The subscription belongs to owner, who
+// added it, until owner leaves the team, and emails are sent to the recipients of the team.
+func (t *Team) Subscribe(owner User, repo string, pref EmailPreference) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to subscribe, invalid DB Connection")
+	}
+	if existing, _ := t.GetSubscriptions(repo); existing != nil {
+		return fmt.Errorf("Failed to subscribe, subscription already exists")
+	}
+	sub := Subscription{
+		UserID:          owner.ID,
+		TeamID:          t.ID,
+		Repo:            repo,
+		EmailPreference: pref,
+		DefaultEmail:    t.Email,
+	}
+	if err := DB.Create(&sub).Error; err != nil {
+		return err
+	}
+	t.Subscriptions = append(t.Subscriptions, sub)
+	return nil
+}
+
+// UpdateSubscription updates the preferences of a team subscription
+func (t *Team) UpdateSubscription(repo string, s *Subscription) error {
+	subs, err := t.GetSubscriptions(repo)
+	if err != nil {
+		return err
+	}
+	return updateSubscription(subs[0], s)
+}
+
+// Unsubscribe removes subscriptions from the team
+func (t *Team) Unsubscribe(repos ...string) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to unsubscribe, invalid DB Connection")
+	}
+	subs, err := t.GetSubscriptions(repos...)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if err := DB.Delete(&sub).Error; err != nil {
+			return fmt.Errorf("Failed to unsubscribe:%v", sub.ID)
+		}
+	}
+	t.Subscriptions = unsubscriber(t.Subscriptions, subs)
+	return nil
+}
+
+// DigestSubscriptions returns the subscriptions of the team with the team's email, so
+// that the activity of all of them is composed into a single digest
+func (t Team) DigestSubscriptions() []Subscription {
+	subs := make([]Subscription, len(t.Subscriptions))
+	for i, sub := range t.Subscriptions {
+		sub.DefaultEmail = t.Email
+		subs[i] = sub
+	}
+	return subs
+}
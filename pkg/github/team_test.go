@@ -0,0 +1,129 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTeamRecipients checks that team digests go to the mailing list or to each member
+func TestTeamRecipients(t *testing.T) {
+	members := []TeamMember{
+		{UserID: 1, Owner: true, User: User{ID: 1, Email: "alice@example.com"}},
+		{UserID: 2, User: User{ID: 2, Email: "bob@example.com"}},
+		{UserID: 3, User: User{ID: 3}},
+	}
+	testcases := []struct {
+		team Team
+		want []string
+	}{
+		{Team{Email: "team@example.com", Members: members}, []string{"team@example.com"}},
+		{Team{Members: members}, []string{"alice@example.com", "bob@example.com"}},
+		{Team{}, []string{}},
+	}
+	for _, tc := range testcases {
+		if got := tc.team.Recipients(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Recipients() = %v, want %v", got, tc.want)
+		}
+	}
+}
+
+// TestTeamMembers checks owner and member checks for a team
+func TestTeamMembers(t *testing.T) {
+	team := Team{Members: []TeamMember{{UserID: 1, Owner: true}, {UserID: 2}}}
+	testcases := []struct {
+		user   User
+		member bool
+		owner  bool
+	}{
+		{User{ID: 1}, true, true},
+		{User{ID: 2}, true, false},
+		{User{ID: 3}, false, false},
+	}
+	for _, tc := range testcases {
+		if got := team.IsMember(tc.user); got != tc.member {
+			t.Errorf("IsMember(%d) = %v, want %v", tc.user.ID, got, tc.member)
+		}
+		if got := team.IsOwner(tc.user); got != tc.owner {
+			t.Errorf("IsOwner(%d) = %v, want %v", tc.user.ID, got, tc.owner)
+		}
+	}
+}
+
+// TestDigestSubscriptions checks that all subscriptions of a team share one digest
+func TestDigestSubscriptions(t *testing.T) {
+	team := Team{
+		Email: "team@example.com",
+		Subscriptions: []Subscription{
+			{Repo: "golang/go", DefaultEmail: "old@example.com"},
+			{Repo: "kubernetes/*"},
+		},
+	}
+	for _, sub := range team.DigestSubscriptions() {
+		if sub.DefaultEmail != team.Email {
+			t.Errorf("DigestSubscriptions() for %s sends to %q, want %q", sub.Repo,
+				sub.DefaultEmail, team.Email)
+		}
+	}
+	if team.Subscriptions[0].DefaultEmail != "old@example.com" {
+		t.Errorf("DigestSubscriptions() changed the subscriptions of the team")
+	}
+}
+
+// TestTeamSuccessor checks who takes over the subscriptions of a member that leaves
+func TestTeamSuccessor(t *testing.T) {
+	testcases := []struct {
+		members []TeamMember
+		userID  uint64
+		want    uint64 // 0 if nobody is left
+	}{
+		{[]TeamMember{{UserID: 1, Owner: true}, {UserID: 2}, {UserID: 3, Owner: true}}, 1, 3},
+		{[]TeamMember{{UserID: 1, Owner: true}, {UserID: 2}, {UserID: 3}}, 1, 2},
+		{[]TeamMember{{UserID: 1}, {UserID: 2, Owner: true}}, 1, 2},
+		{[]TeamMember{{UserID: 1, Owner: true}}, 1, 0},
+	}
+	for _, tc := range testcases {
+		team := Team{Members: tc.members}
+		got, ok := team.successor(tc.userID)
+		if !ok {
+			got.UserID = 0
+		}
+		if got.UserID != tc.want {
+			t.Errorf("successor(%d) of %v = %d, want %d", tc.userID, tc.members, got.UserID,
+				tc.want)
+		}
+	}
+}
+
+// TestTeamLastOwner checks that only the sole owner of a team is its last owner
+func TestTeamLastOwner(t *testing.T) {
+	testcases := []struct {
+		members []TeamMember
+		userID  uint64
+		want    bool
+	}{
+		{[]TeamMember{{UserID: 1, Owner: true}, {UserID: 2}}, 1, true},
+		{[]TeamMember{{UserID: 1, Owner: true}, {UserID: 2}}, 2, false},
+		{[]TeamMember{{UserID: 1, Owner: true}, {UserID: 2, Owner: true}}, 1, false},
+		{[]TeamMember{{UserID: 1, Owner: true}}, 3, false},
+	}
+	for _, tc := range testcases {
+		team := Team{Members: tc.members}
+		if got := team.LastOwner(User{ID: tc.userID}); got != tc.want {
+			t.Errorf("LastOwner(%d) of %v = %v, want %v", tc.userID, tc.members, got, tc.want)
+		}
+	}
+}
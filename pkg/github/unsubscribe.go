@@ -0,0 +1,104 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Digests link to the unsubscribe handler of the backend with a token that names the user
+// and the repo to unsubscribe from, or no repo to unsubscribe from all repos. Team digests
+// sent to each member link to it with a token that names the member and the team to leave.
+// Tokens are signed with a secret shared by the mailer and the backend, so that the links
+// work without logging in and can't be changed to unsubscribe other users.
+
+// UnsubscribeToken returns the token that unsubscribes the user with userID from repo, or
+// from all repos if repo is empty, signed with secret
+func UnsubscribeToken(secret string, userID uint64, repo string) string {
+	return signToken(secret, "unsubscribe", userID, repo)
+}
+
+// ParseUnsubscribeToken returns the user ID and repo of a token returned by
+// UnsubscribeToken, or an error if it isn't signed with secret
+func ParseUnsubscribeToken(secret string, token string) (uint64, string, error) {
+	return parseToken(secret, "unsubscribe", token)
+}
+
+// LeaveTeamToken returns the token that removes the user with userID from the team with
+// teamID, signed with secret
+func LeaveTeamToken(secret string, userID uint64, teamID uint) string {
+	return signToken(secret, "leave", userID, strconv.FormatUint(uint64(teamID), 10))
+}
+
+// ParseLeaveTeamToken returns the user ID and team ID of a token returned by
+// LeaveTeamToken, or an error if it isn't signed with secret
+func ParseLeaveTeamToken(secret string, token string) (uint64, uint, error) {
+	userID, team, err := parseToken(secret, "leave", token)
+	if err != nil {
+		return 0, 0, err
+	}
+	teamID, err := strconv.ParseUint(team, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid unsubscribe token: %v", err)
+	}
+	return userID, uint(teamID), nil
+}
+
+// signToken returns the token of the given kind for the user with userID and value,
+// signed with secret
+func signToken(secret string, kind string, userID uint64, value string) string {
+	payload := strconv.FormatUint(userID, 10) + ":" + value
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(tokenMAC(secret, kind, payload))
+}
+
+// parseToken returns the user ID and value of a token of the given kind returned by
+// signToken, or an error if it isn't signed with secret
+func parseToken(secret string, kind string, token string) (uint64, string, error) {
+	parts := strings.Split(token, ".")
+	if len(secret) == 0 || len(parts) != 2 {
+		return 0, "", fmt.Errorf("Invalid unsubscribe token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("Invalid unsubscribe token: %v", err)
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, tokenMAC(secret, kind, string(payload))) {
+		return 0, "", fmt.Errorf("Invalid unsubscribe token signature")
+	}
+	fields := strings.SplitN(string(payload), ":", 2)
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("Invalid unsubscribe token")
+	}
+	userID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("Invalid unsubscribe token: %v", err)
+	}
+	return userID, fields[1], nil
+}
+
+// tokenMAC returns the HMAC of the payload of a token of the given kind with secret. The
+// kind is signed with the payload, so that a token can't be used as one of another kind.
+func tokenMAC(secret string, kind string, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(kind + ":" + payload))
+	return mac.Sum(nil)
+}
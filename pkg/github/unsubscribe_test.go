@@ -0,0 +1,62 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	for _, repo := range []string{"GoogleCloudPlatform/issuetracker", "myorg/*", ""} {
+		token := UnsubscribeToken("secret", 1234, repo)
+		userID, got, err := ParseUnsubscribeToken("secret", token)
+		if err != nil || userID != 1234 || got != repo {
+			t.Errorf("ParseUnsubscribeToken(%q) got %d, %q, %v, wanted 1234, %q",
+				token, userID, got, err, repo)
+		}
+	}
+
+	token := UnsubscribeToken("secret", 1234, "GoogleCloudPlatform/issuetracker")
+	other := UnsubscribeToken("secret", 1, "GoogleCloudPlatform/issuetracker")
+	invalid := map[string]struct{ secret, token string }{
+		"wrong secret":  {"other", token},
+		"no secret":     {"", UnsubscribeToken("", 1234, "")},
+		"changed user":  {"secret", strings.Split(other, ".")[0] + "." + strings.Split(token, ".")[1]},
+		"no signature":  {"secret", strings.Split(token, ".")[0]},
+		"invalid token": {"secret", "not a token"},
+	}
+	for testcase, test := range invalid {
+		if _, _, err := ParseUnsubscribeToken(test.secret, test.token); err == nil {
+			t.Errorf("%s: ParseUnsubscribeToken() got no error", testcase)
+		}
+	}
+}
+
+func TestLeaveTeamToken(t *testing.T) {
+	token := LeaveTeamToken("secret", 1234, 56)
+	userID, teamID, err := ParseLeaveTeamToken("secret", token)
+	if err != nil || userID != 1234 || teamID != 56 {
+		t.Errorf("ParseLeaveTeamToken(%q) got %d, %d, %v, wanted 1234, 56", token, userID,
+			teamID, err)
+	}
+	// Tokens of one kind can't be used as the other
+	if _, _, err := ParseUnsubscribeToken("secret", token); err == nil {
+		t.Errorf("ParseUnsubscribeToken() of a leave team token got no error")
+	}
+	if _, _, err := ParseLeaveTeamToken("secret", UnsubscribeToken("secret", 1234, "56")); err == nil {
+		t.Errorf("ParseLeaveTeamToken() of an unsubscribe token got no error")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// QueryUsage stores the number of bytes scanned by BigQuery queries on a day
+type QueryUsage struct {
+	Day       string `gorm:"primary_key;size:8"` // day formatted as YYYYMMDD
+	Bytes     int64  `gorm:"not null;"`          // total bytes processed by queries
+	Queries   int64  `gorm:"not null;"`          // number of queries run
+	UpdatedAt time.Time
+}
+
+// queryUsageStore records BigQuery usage in the database, it implements bq.Usage
+type queryUsageStore struct{}
+
+// Scanned returns the number of bytes scanned by queries on day
+func (queryUsageStore) Scanned(ctx context.Context, day string) (int64, error) {
+	if DB == nil {
+		return 0, fmt.Errorf("Failed to get query usage, invalid DB Connection")
+	}
+	var usage QueryUsage
+	query := DB.First(&usage, "day = ?", day)
+	if query.RecordNotFound() {
+		return 0, nil
+	}
+	return usage.Bytes, query.Error
+}
+
+// Add adds bytes to the number of bytes scanned by queries on day
+func (queryUsageStore) Add(ctx context.Context, day string, bytes int64) error {
+	if DB == nil {
+		return fmt.Errorf("Failed to add query usage, invalid DB Connection")
+	}
+	return DB.Exec(`INSERT INTO query_usages (day, bytes, queries, updated_at)
+		VALUES (?, ?, 1, ?) ON DUPLICATE KEY UPDATE
+		bytes = bytes + VALUES(bytes), queries = queries + 1, updated_at = VALUES(updated_at)`,
+		day, bytes, time.Now()).Error
+}
+
+// GetQueryUsage returns the BigQuery usage for the most recent days, newest first
+func GetQueryUsage(days int) ([]QueryUsage, error) {
+	results := []QueryUsage{}
+	if DB == nil {
+		return nil, fmt.Errorf("Failed to get query usage, invalid DB Connection")
+	}
+	err := DB.Order("day DESC").Limit(days).Find(&results).Error
+	return results, err
+}
@@ -32,13 +32,37 @@ type Frequency int
 
 // Named frequency constants to help make code readable
 const (
-	_                 = iota // skip 0 value
-	Never   Frequency = iota // 1
-	Daily                    // 2
-	Weekly                   // 3
-	Monthly                  // 4
+	_                    = iota // skip 0 value
+	Never      Frequency = iota // 1
+	Daily                       // 2
+	Weekly                      // 3
+	Monthly                     // 4
+	Immediate                   // 5, sent for each ImmediateInterval with activity
+	Hourly                      // 6
+	TwiceDaily                  // 7, at the delivery hour and 12 hours later
+	Scheduled                   // 8, at the times of the subscription's Schedule
 )
 
+// ImmediateInterval is the time covered by each notification for the Immediate frequency
+const ImmediateInterval = 5 * time.Minute
+
+// Frequent reports whether digests of frequency f are sent more than once a day
+func (f Frequency) Frequent() bool {
+	return f == Immediate || f == Hourly || f == TwiceDaily
+}
+
+// Has reports whether any type of notification is sent with frequency f
+func (p EmailPreference) Has(f Frequency) bool {
+	for _, x := range []Frequency{p.IssueOpen, p.IssueClose, p.IssueReopen, p.NewComment,
+		p.NoComment, p.PullOpen, p.PullMerge, p.PullClose, p.PullReviewRequest, p.PullReview,
+		p.PullReviewComment, p.Release, p.Star, p.Fork} {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
 // EmailPreference stores frequency for various types of notifications
 type EmailPreference struct {
 	SubscriptionID uint      `gorm:"unique;index;not null;"`
@@ -47,6 +71,17 @@ type EmailPreference struct {
 	IssueReopen    Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
 	NewComment     Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
 	NoComment      Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+
+	PullOpen          Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	PullMerge         Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	PullClose         Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	PullReviewRequest Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	PullReview        Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	PullReviewComment Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+
+	Release Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	Star    Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
+	Fork    Frequency `gorm:"type:INT;" sql:"DEFAULT:1"`
 }
 
 // Repo stores open issue count for repositories
@@ -65,6 +100,17 @@ func NewPreference() EmailPreference {
 		IssueReopen: Daily,
 		NewComment:  Daily,
 		NoComment:   Daily,
+
+		PullOpen:          Daily,
+		PullMerge:         Daily,
+		PullClose:         Daily,
+		PullReviewRequest: Daily,
+		PullReview:        Daily,
+		PullReviewComment: Daily,
+
+		Release: Daily,
+		Star:    Daily,
+		Fork:    Daily,
 	}
 }
 
@@ -75,7 +121,11 @@ type Subscription struct {
 	Repo               string          `gorm:"index;not null;"`
 	DefaultEmail       string          `gorm:"not null;"`
 	EmailPreference    EmailPreference `gorm:"ForeignKey:SubscriptionID"`
-	LastNotificationID uint64          // Last notification’s ID for sending reminders if needed
+	LastNotificationID uint64          // Last notification’s ID with the subscription's activity
+	Source             string          `gorm:"size:16;"`                  // Event source for the repo, empty for the default
+	Filter             Filter          `gorm:"ForeignKey:SubscriptionID"` // Rules for the activity sent
+	TeamID             uint            `gorm:"index;"`                    // Team that shares the subscription, 0 for a user's own
+	Schedule           string          `gorm:"size:64;"`                  // Cron style schedule for Scheduled digests
 
 }
 
@@ -86,6 +136,8 @@ type User struct {
 	Login         string         `gorm:"unique_index;"` // Github ID for the user
 	Email         string         `gorm:"unique_index;"` // User's default email
 	Subscriptions []Subscription `gorm:"ForeignKey:UserID"`
+	Timezone      string         `gorm:"size:64;"`    // IANA time zone for digests, empty for Pacific time
+	DeliveryHour  int            `gorm:"default:23;"` // Hour of the day in Timezone that digests are sent at
 	CreatedAt     time.Time
 }
 
@@ -109,7 +161,8 @@ func (u *User) Add() error {
 // IsNew returns true if there is an entry for the given user in the database
 func (u *User) IsNew() (User, bool) {
 	var user User
-	if DB.Preload("Subscriptions").Preload("Subscriptions.EmailPreference").
+	if DB.Preload("Subscriptions", "team_id = ?", 0).Preload("Subscriptions.EmailPreference").
+		Preload("Subscriptions.Filter").
 		First(&user, "id = ?", u.ID).RecordNotFound() {
 		return User{}, true
 	}
@@ -140,6 +193,23 @@ func (u User) Remove() error {
 		return fmt.Errorf("Failed to remove user, invalid ID")
 	}
 
+	// Team subscriptions added by the user outlive the user, unless it was the only member
+	teams, err := u.GetTeams()
+	if err != nil {
+		return err
+	}
+	for i := range teams {
+		ok, err := teams[i].handOver(u.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := teams[i].Remove(); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := DB.Delete(&u).Error; err != nil {
 		return err
 	}
@@ -187,12 +257,13 @@ func (u User) GetSubscriptions(repos ...string) ([]Subscription, error) {
 	}
 	if len(repos) == 0 {
 		// Get all subscriptions
-		err := DB.Preload("EmailPreference").Find(&results, "user_id = ?", u.ID).Error
+		err := DB.Preload("EmailPreference").Preload("Filter").
+			Find(&results, "user_id = ? AND team_id = 0", u.ID).Error
 		return results, err
 	}
 	for _, repo := range repos {
 		var sub Subscription
-		if DB.Preload("EmailPreference").Where("user_id = ? AND repo = ?", u.ID, repo).First(&sub).RecordNotFound() == false {
+		if DB.Preload("EmailPreference").Preload("Filter").Where("user_id = ? AND team_id = 0 AND repo = ?", u.ID, repo).First(&sub).RecordNotFound() == false {
 			results = append(results, sub)
 		} else {
 			return nil, fmt.Errorf("No such subscription: %s", repo)
@@ -207,7 +278,7 @@ func (u *User) UnsubscribeAll() error {
 	if err != nil {
 		return err
 	}
-	err = DB.Where("user_id = ?", u.ID).Delete(Subscription{}).Error
+	err = DB.Where("user_id = ? AND team_id = 0", u.ID).Delete(Subscription{}).Error
 	u.Subscriptions = unsubscriber(u.Subscriptions, subs)
 	return err
 }
@@ -222,7 +293,7 @@ func (u *User) Unsubscribe(repos ...string) error {
 		var subs []Subscription
 		for _, repo := range repos {
 			var sub Subscription
-			if DB.Where("user_id = ? AND repo = ?", u.ID, repo).First(&sub).RecordNotFound() == false {
+			if DB.Where("user_id = ? AND team_id = 0 AND repo = ?", u.ID, repo).First(&sub).RecordNotFound() == false {
 				if DB.Delete(&sub).Error != nil {
 					return fmt.Errorf("Failed to unsubscribe:%v", sub.ID)
 				}
@@ -242,15 +313,28 @@ func (u *User) UpdateSubscription(repo string, s *Subscription) error {
 	if err != nil {
 		return err
 	}
-	sub := subs[0]
+	return updateSubscription(subs[0], s)
+}
+
+// updateSubscription replaces the preferences and filter of sub with the ones of s
+func updateSubscription(sub Subscription, s *Subscription) error {
 	DB.Delete(&EmailPreference{}, "subscription_id = ?", sub.ID)
 	s.EmailPreference.SubscriptionID = sub.ID
-	err = DB.Save(&s.EmailPreference).Error
+	err := DB.Save(&s.EmailPreference).Error
 	if err != nil {
 
 		return fmt.Errorf("Failed to update preferences: %v", err)
 	}
-	return DB.Model(&sub).UpdateColumns(s).Error
+	DB.Delete(&Filter{}, "subscription_id = ?", sub.ID)
+	s.Filter.SubscriptionID = sub.ID
+	if err = DB.Save(&s.Filter).Error; err != nil {
+		return fmt.Errorf("Failed to update filter: %v", err)
+	}
+	if err := DB.Model(&sub).UpdateColumns(s).Error; err != nil {
+		return err
+	}
+	// UpdateColumns skips empty fields, so an empty source is saved to reset it to the default
+	return DB.Model(&sub).UpdateColumn("source", s.Source).Error
 }
 
 // UpdateRepo creates or updates repo data for a repository given by r from Github
@@ -264,6 +348,9 @@ func UpdateRepo(ctx context.Context, r string) error {
 	if err != nil {
 		return err
 	}
+	if rateLimited(resp) {
+		return ErrRateLimited
+	}
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("API Error: %s", resp.Status)
 	}
@@ -312,7 +399,8 @@ func FindUserByLogin(login string) (User, error) {
 	if DB == nil {
 		return user, fmt.Errorf("Failed to FindUserByID, invalid DB Connection")
 	}
-	if err := DB.Preload("Subscriptions").Preload("Subscriptions.EmailPreference").First(&user, "login = ?", login).Error; err != nil {
+	if err := DB.Preload("Subscriptions", "team_id = ?", 0).Preload("Subscriptions.EmailPreference").
+		Preload("Subscriptions.Filter").First(&user, "login = ?", login).Error; err != nil {
 		return user, err
 	}
 	return user, nil
@@ -0,0 +1,192 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// webhookPayload holds the fields of the webhook payloads that are stored
+type webhookPayload struct {
+	Action            string          `json:"action"`
+	Issue             *apiIssue       `json:"issue"`
+	Comment           *apiComment     `json:"comment"`
+	PullRequest       *apiPullRequest `json:"pull_request"`
+	Review            *apiReview      `json:"review"`
+	Release           *apiRelease     `json:"release"`
+	Forkee            *apiRepo        `json:"forkee"`
+	RequestedReviewer *apiUser        `json:"requested_reviewer"`
+	Sender            apiUser         `json:"sender"`
+	Repository        struct {
+		URL string `json:"url"`
+	} `json:"repository"`
+}
+
+// webhookEvents are the webhook events that are stored by SaveWebhook
+var webhookEvents = map[string]bool{
+	"issues":                      true,
+	"issue_comment":               true,
+	"pull_request":                true,
+	"pull_request_review":         true,
+	"pull_request_review_comment": true,
+	"release":                     true,
+	"watch":                       true,
+	"fork":                        true,
+}
+
+// VerifyWebhook returns true if signature, the value of the X-Hub-Signature-256 header
+// of a webhook request, is the HMAC of body with secret
+func VerifyWebhook(secret string, signature string, body []byte) bool {
+	const prefix = "sha256="
+	if len(secret) == 0 || !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+	got, err := hex.DecodeString(signature[len(prefix):])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// SaveWebhook stores the GitHub activity in the body of a webhook for event, the value
+// of the X-GitHub-Event header. It returns false for events that
+// aren't stored.
+func SaveWebhook(event string, body []byte) (bool, error) {
+	if !webhookEvents[event] {
+		return false, nil
+	}
+	if DB == nil {
+		return false, fmt.Errorf("Failed to save %s event, invalid DB Connection", event)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return false, fmt.Errorf("Failed to save %s event, invalid JSON: %v", event, err)
+	}
+	switch {
+	case event == "issue_comment" && p.Comment != nil && p.Issue != nil:
+		return true, saveComment(p.Action, p.Comment.toComment(p.Issue.RepositoryURL))
+	case event == "issues" && p.Issue != nil:
+		return true, saveIssue(p.Action, p.Issue.toIssue(p.Issue.CreatedAt))
+	case event == "pull_request" && p.PullRequest != nil:
+		action := p.Action
+		actor := p.Sender.Login
+		if action == "closed" && p.PullRequest.MergedAt != nil {
+			action = "merged"
+			if p.PullRequest.MergedBy != nil {
+				actor = p.PullRequest.MergedBy.Login
+			}
+		}
+		pull := p.PullRequest.toPullRequest(action, actor, p.PullRequest.CreatedAt)
+		if p.RequestedReviewer != nil {
+			pull.Reviewer = p.RequestedReviewer.Login
+		}
+		return true, savePullRequest(pull)
+	case event == "pull_request_review" && p.Review != nil && p.PullRequest != nil:
+		review := p.Review.toReview(*p.PullRequest)
+		return true, DB.Save(&review).Error
+	case event == "pull_request_review_comment" && p.Comment != nil && p.PullRequest != nil:
+		review := p.Comment.toReview(p.PullRequest.Base.Repo.URL, p.PullRequest.Number,
+			p.PullRequest.Title)
+		if p.Action == "deleted" {
+			return true, DB.Delete(&review).Error
+		}
+		return true, DB.Save(&review).Error
+	case event == "release" && p.Release != nil:
+		if p.Action != "published" {
+			return false, nil
+		}
+		release := p.Release.toRelease(p.Repository.URL)
+		return true, DB.Save(&release).Error
+	case event == "fork" && p.Forkee != nil:
+		fork := p.Forkee.toFork(p.Repository.URL)
+		return true, DB.Save(&fork).Error
+	case event == "watch":
+		// Watch events have no time, and are sent again when the delivery is retried or the
+		// repo is starred again, so the star is kept with the time it was first received
+		var star Star
+		err := DB.Where(Star{User: p.Sender.Login, Repo: p.Repository.URL}).
+			Attrs(Star{Created: time.Now()}).FirstOrCreate(&star).Error
+		if duplicate(err) {
+			// A concurrent delivery of the event stored the star
+			return true, nil
+		}
+		return true, err
+	}
+	return false, fmt.Errorf("Failed to save %s event, missing payload", event)
+}
+
+// duplicate reports whether err is the MySQL error for a duplicate key
+func duplicate(err error) bool {
+	e, ok := err.(*mysql.MySQLError)
+	return ok && e.Number == 1062
+}
+
+// saveIssue creates, updates or deletes the stored issue for action. The action is kept
+// for opened, closed and reopened issues, other actions only update the issue.
+func saveIssue(action string, issue Issue) error {
+	if action == "deleted" {
+		return DB.Delete(&issue).Error
+	}
+	if isIssueAction(action) {
+		issue.Action = action
+	} else {
+		var stored Issue
+		if !DB.First(&stored, "id = ?", issue.ID).RecordNotFound() {
+			issue.Action = stored.Action
+		}
+	}
+	return DB.Save(&issue).Error
+}
+
+// savePullRequest creates or updates the stored pull request. The action is kept for
+// opened, merged, closed and review_requested pull requests, other actions only update
+// the pull request.
+func savePullRequest(pull PullRequest) error {
+	switch pull.Action {
+	case "opened", "merged", "closed", "review_requested":
+	default:
+		var stored PullRequest
+		pull.Action = ""
+		if !DB.First(&stored, "id = ?", pull.ID).RecordNotFound() {
+			pull.Action = stored.Action
+			pull.Actor = stored.Actor
+			pull.Reviewer = stored.Reviewer
+		}
+	}
+	return DB.Save(&pull).Error
+}
+
+// saveComment creates, updates or deletes the stored comment for action
+func saveComment(action string, comment Comment) error {
+	if action == "deleted" {
+		return DB.Delete(&comment).Error
+	}
+	return DB.Save(&comment).Error
+}
+
+// isIssueAction returns true for actions on issues that are sent in digests
+func isIssueAction(action string) bool {
+	return action == "opened" || action == "closed" || action == "reopened"
+}
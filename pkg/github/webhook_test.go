@@ -0,0 +1,78 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var verifyTests = []struct {
+	testcase  string
+	secret    string
+	signature string
+	want      bool
+}{
+	{
+		"Valid signature",
+		"It's a Secret to Everybody",
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		true,
+	},
+	{
+		"Wrong secret",
+		"It's not a Secret",
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		false,
+	},
+	{
+		"Missing prefix",
+		"It's a Secret to Everybody",
+		"757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		false,
+	},
+	{
+		"Invalid hex",
+		"It's a Secret to Everybody",
+		"sha256=not-hex",
+		false,
+	},
+	{
+		"No secret set",
+		"",
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		false,
+	},
+}
+
+// TestVerifyWebhook tests checking X-Hub-Signature-256 signatures
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte("Hello, World!")
+	for _, test := range verifyTests {
+		if got := VerifyWebhook(test.secret, test.signature, body); got != test.want {
+			t.Errorf("%s: VerifyWebhook() got %v, want %v", test.testcase, got, test.want)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	if !duplicate(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}) {
+		t.Errorf("duplicate() got false for a duplicate key error")
+	}
+	if duplicate(&mysql.MySQLError{Number: 1146}) || duplicate(nil) {
+		t.Errorf("duplicate() got true for other errors")
+	}
+}
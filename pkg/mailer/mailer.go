@@ -20,8 +20,15 @@ package mailer
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
@@ -31,11 +38,28 @@ import (
 
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/mail"
 	"google.golang.org/appengine/taskqueue"
 )
 
-// EmailCronHandler handles creation of task queues for each user for that type of email
+// source provides the GitHub activity for digests, set by the EVENT_SOURCE environment
+// variable to "bigquery" or "github"
+var source = github.NewSource(os.Getenv("EVENT_SOURCE"))
+
+// transport sends the emails, set by the MAIL_TRANSPORT environment variable to
+// "appengine", "smtp" or "file"
+var transport = NewTransport(os.Getenv("MAIL_TRANSPORT"))
+
+// scheduledTypes are the types of email sent by the cron job for email=scheduled when
+// they are due for a subscription
+var scheduledTypes = []string{"daily", "weekly", "monthly", "twicedaily", "hourly", "scheduled"}
+
+// EmailCronHandler handles creation of task queues for each user and team for that type
+// of email
+//
+// With batch=true the activity of all subscriptions is fetched once and shared by the
+// tasks, otherwise each task fetches the data for its own user. With dry=true the tasks
+// log their recipients and the sizes of the digests instead of sending them. Tasks are
+// given the time of the cron run, so that retries send the digests of the same windows.
 func EmailCronHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx := appengine.NewContext(r)
@@ -45,18 +69,55 @@ func EmailCronHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	for _, user := range users {
-		// Push a task for the user's daily email
-		hostHeader := http.Header{}
-		hostHeader.Set("Host", "mailer")
-		t := taskqueue.Task{
-			Header: hostHeader,
-			Path:   "/emailtask?type=" + emailType + "&user=" + user.Login,
-			Method: "GET",
-		}
-		_, err := taskqueue.Add(ctx, &t, emailType)
+	dry := r.URL.Query().Get("dry") == "true"
+	if emailType == "scheduled" {
+		err := addScheduledTasks(ctx, users, r.URL.Query().Get("batch") == "true", dry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	teams, err := github.GetTeams()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batch := ""
+	if r.URL.Query().Get("batch") == "true" {
+		batch, err = fetchBatch(ctx, getFrequency(emailType))
+		if err != nil {
+			// Tasks fall back to fetching data for each user
+			log.Errorf(ctx, "Failed to fetch %s batch: %v", emailType, err)
+		}
+	}
+	if getFrequency(emailType) == github.Immediate {
+		// Immediate runs every few minutes, so tasks are only added for subscribers
+		users, teams, err = immediateSubscribers(users, teams)
 		if err != nil {
-			log.Errorf(ctx, "Failed to create email task: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	paths := []string{}
+	for _, user := range users {
+		paths = append(paths, "/emailtask?type="+emailType+"&user="+user.Login)
+	}
+	for _, team := range teams {
+		paths = append(paths, "/emailtask?type="+emailType+"&team="+strconv.Itoa(int(team.ID)))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, path := range paths {
+		// Push a task for the user's or team's daily email
+		path = path + "&time=" + now
+		if batch != "" {
+			path = path + "&batch=" + batch
+		}
+		if dry {
+			path = path + "&dry=true"
+		}
+		if err := addTask(ctx, path, emailType); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -65,79 +126,576 @@ func EmailCronHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// addScheduledTasks adds tasks for the users and teams with digests due at the current
+// github.ScheduleTime in their time zone. With batch the activity of each due window is
+// fetched once and shared by the tasks, with dry the tasks don't send the digests.
+func addScheduledTasks(ctx context.Context, users []github.User, batch bool, dry bool) error {
+	at := github.ScheduleTime(time.Now())
+	subscriptions, err := github.GetAllSubscriptions()
+	if err != nil {
+		return err
+	}
+	logins := map[uint64]string{}
+	deliveries := github.Deliveries{}
+	for _, user := range users {
+		logins[user.ID] = user.Login
+		deliveries[user.ID] = user.Delivery()
+	}
+	for _, emailType := range scheduledTypes {
+		frequency := getFrequency(emailType)
+		paths := map[string]bool{}
+		for _, digest := range github.DueDigests(subscriptions, frequency, at, deliveries) {
+			if batch {
+				_, err := github.FetchWindowBatch(ctx, source, digest.Subscriptions, frequency,
+					digest.Window)
+				if err != nil {
+					// Tasks fall back to fetching data for each user
+					log.Errorf(ctx, "Failed to fetch %s batch: %v", emailType, err)
+				}
+			}
+			for _, sub := range digest.Subscriptions {
+				path := "/emailtask?type=" + emailType + "&at=" + strconv.FormatInt(at.Unix(), 10)
+				if sub.TeamID != 0 {
+					path = path + "&team=" + strconv.Itoa(int(sub.TeamID))
+				} else if login, ok := logins[sub.UserID]; ok {
+					path = path + "&user=" + login
+				} else {
+					continue
+				}
+				if batch {
+					path = path + "&batch=true"
+				}
+				if dry {
+					path = path + "&dry=true"
+				}
+				paths[path] = true
+			}
+		}
+		for path := range paths {
+			if err := addTask(ctx, path, "scheduled"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addTask pushes an email task for path to queue
+func addTask(ctx context.Context, path string, queue string) error {
+	hostHeader := http.Header{}
+	hostHeader.Set("Host", "mailer")
+	t := taskqueue.Task{
+		Header: hostHeader,
+		Path:   path,
+		Method: "GET",
+	}
+	if _, err := taskqueue.Add(ctx, &t, queue); err != nil {
+		log.Errorf(ctx, "Failed to create email task: %v", err)
+		return err
+	}
+	return nil
+}
+
 // EmailTaskHandler handles sending daily emails triggered by a cron job,
 // data for the email is pulled from BigQuery
+//
+// With dry=true the recipients and the sizes of the digests are logged instead of sending
+// them, and no notifications are recorded. The digests end at the time of the cron run
+// given by time, or when the task runs without it.
 func EmailTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx := appengine.NewContext(r)
+	dry := r.URL.Query().Get("dry") == "true"
 
 	userLogin := r.URL.Query().Get("user")
 	emailType := r.URL.Query().Get("type")
+	at, err := scheduleTime(r.URL.Query().Get("at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now, err := taskTime(r.URL.Query().Get("time"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if team := r.URL.Query().Get("team"); team != "" {
+		err := emailTeam(ctx, team, emailType, r.URL.Query().Get("batch"), at, now, dry)
+		if err != nil {
+			log.Errorf(ctx, "Error sending team email:%v", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 	user, err := github.FindUserByLogin(userLogin)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	emailFrequency := getFrequency(emailType)
+	delivery := user.Delivery()
 	// Fetch Email Data for user
-	results, err := github.FetchData(ctx, user.Subscriptions, emailFrequency)
+	results, err := fetchData(ctx, user.Subscriptions, emailFrequency, r.URL.Query().Get("batch"),
+		at, now, github.Deliveries{user.ID: delivery})
 	if err != nil {
 		log.Errorf(ctx, "Error getting data:%v", err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	failed := 0
 	for _, data := range results {
 
 		if isEmpty(ctx, data.Content) {
 			log.Infof(ctx, "No %s content for: %s", emailType, data.Email)
+			if !dry {
+				markDigest(ctx, emailFrequency, data)
+			}
 			continue
 		}
 		// Compose email content
-		emailContent, err := composeEmailContent(user.Login, emailType, data.Content)
+		unsubscribe := unsubscribeLinks(ctx, user.ID, user.Subscriptions)
+		emailContent, emailText, err := composeEmails(user.Login, false, emailType, data.Content,
+			delivery.Location, unsubscribe)
 		if err != nil {
 			log.Errorf(ctx, err.Error())
+			failed++
+		} else if dry {
+			logDryRun(ctx, emailType, []string{data.Email}, data, emailContent, emailText)
+		} else if claimed, err := user.ClaimDigest(data.Email, emailFrequency,
+			data.Window); err != nil {
+			log.Errorf(ctx, "%v", err)
+			failed++
+		} else if !claimed {
+			// Skip digests that a previous run of the task sent or another task is sending
+			log.Infof(ctx, "Already sent %s digest to: %s", emailType, data.Email)
 		} else {
 			// Send out daily email report &  record the notification data
-			subject := "GitHub Activity Digest for " + time.Now().Format("Jan 02,2006")
-			err = sendMail(ctx, data.Email, subject, emailContent)
+			subject := digestSubject(emailFrequency, delivery.Location)
+			err = sendMail(ctx, Message{
+				To:              []string{data.Email},
+				Subject:         subject,
+				TextBody:        emailText,
+				HTMLBody:        emailContent,
+				ListUnsubscribe: unsubscribe(""),
+			})
 			if err != nil {
 				log.Errorf(ctx, err.Error())
+				if err := user.ReleaseDigest(data.Email, emailFrequency, data.Window); err != nil {
+					log.Errorf(ctx, "%v", err)
+				}
+				failed++
 			} else {
-				// Save notification data
-				user.AddNotification(ctx, data.Email, emailFrequency, data.Content)
+				// Save notification data, the next digest starts where this one ended
+				err := user.AddDigestNotification(ctx, data.Email, emailFrequency, data)
+				if err != nil {
+					log.Errorf(ctx, "Failed to save notification: %v", err)
+					failed++
+				}
 			}
 		}
 	}
+	if failed != 0 {
+		// Retry the task, digests that were sent are skipped
+		http.Error(w, fmt.Sprintf("Failed to send %d emails", failed), http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 
 }
 
-// composeEmailContent populates an email template with issues
-func composeEmailContent(user string, emailType string, data []github.Payload) (string, error) {
+// emailTeam sends the digest for the subscriptions of the team with the given ID to the
+// team's mailing list, or to each member if the team has none. With dry the digests are
+// logged instead.
+func emailTeam(ctx context.Context, id string, emailType string, batch string, at time.Time,
+	now time.Time, dry bool) error {
+	teamID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	team, err := github.FindTeam(uint(teamID))
+	if err != nil {
+		return err
+	}
+	if len(team.Subscriptions) == 0 {
+		log.Infof(ctx, "No subscriptions for team: %s", team.Name)
+		return nil
+	}
+	emailFrequency := getFrequency(emailType)
+	delivery := github.DefaultDelivery()
+	results, err := fetchData(ctx, team.DigestSubscriptions(), emailFrequency, batch, at, now, nil)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, data := range results {
+		if isEmpty(ctx, data.Content) {
+			log.Infof(ctx, "No %s content for team: %s", emailType, team.Name)
+			if !dry {
+				markDigest(ctx, emailFrequency, data)
+			}
+			continue
+		}
+		if dry {
+			emailContent, emailText, err := composeEmails(team.Name, true, emailType,
+				data.Content, delivery.Location, noLinks)
+			if err != nil {
+				log.Errorf(ctx, "%v", err)
+				failed++
+				continue
+			}
+			logDryRun(ctx, emailType, team.Recipients(), data, emailContent, emailText)
+			continue
+		}
+		date := digestDate(emailFrequency, delivery.Location)
+		subject := "GitHub Activity Digest for " + team.Name + " for " + date
+		if emailFrequency == github.Immediate {
+			subject = "New GitHub Activity for " + team.Name + " at " + date
+		}
+		sent, marked := true, false
+		recipients := team.Recipients()
+		for i, to := range recipients {
+			// Team subscriptions are changed by the owners of the team, so the digests of
+			// members link to leaving the team instead of unsubscribing
+			links := leaveTeamLinks(ctx, team, to)
+			emailContent, emailText, err := composeEmails(team.Name, true, emailType,
+				data.Content, delivery.Location, links)
+			if err != nil {
+				log.Errorf(ctx, "%v", err)
+				sent = false
+				continue
+			}
+			// Skip recipients that a previous run of the task reached or another task is
+			// sending to
+			if claimed, err := team.ClaimDigest(to, emailFrequency, data.Window); err != nil {
+				log.Errorf(ctx, "%v", err)
+				sent = false
+				continue
+			} else if !claimed {
+				log.Infof(ctx, "Already sent %s team digest to: %s", emailType, to)
+				continue
+			}
+			err = sendMail(ctx, Message{
+				To:              []string{to},
+				Subject:         subject,
+				TextBody:        emailText,
+				HTMLBody:        emailContent,
+				ListUnsubscribe: links(""),
+			})
+			if err != nil {
+				log.Errorf(ctx, "%v", err)
+				if err := team.ReleaseDigest(to, emailFrequency, data.Window); err != nil {
+					log.Errorf(ctx, "%v", err)
+				}
+				sent = false
+				continue
+			}
+			// Save notification data for the members that the email reached, the next digest
+			// starts where this one ended once it reached every recipient
+			mark := sent && i == len(recipients)-1
+			if err := team.AddDigestNotification(ctx, to, emailFrequency, data, mark); err != nil {
+				log.Errorf(ctx, "Failed to save notification: %v", err)
+				sent = false
+				continue
+			}
+			marked = mark
+		}
+		if !sent {
+			failed++
+			continue
+		}
+		if !marked {
+			// The last recipients were reached by a previous run of the task
+			markDigest(ctx, emailFrequency, data)
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("Failed to send %d team emails", failed)
+	}
+	return nil
+}
+
+// markDigest marks the subscriptions of a digest that was sent, or had nothing to send, so
+// that the next digest starts where it ended
+func markDigest(ctx context.Context, emailType github.Frequency, data github.EmailPayload) {
+	if err := github.MarkDigest(emailType, data); err != nil {
+		log.Errorf(ctx, "Failed to mark digest for %s: %v", data.Email, err)
+	}
+}
+
+// logDryRun logs the recipients and the sizes of a digest that a dry run doesn't send
+func logDryRun(ctx context.Context, emailType string, to []string, data github.EmailPayload,
+	emailContent string, emailText string) {
+
+	log.Infof(ctx, "Dry run, not sending %s digest to %s: %d repos, %d subscriptions, "+
+		"%d bytes of HTML and %d bytes of text", emailType, strings.Join(to, ", "),
+		len(data.Content), len(data.Subscriptions), len(emailContent), len(emailText))
+}
 
-	pageTemplate, err := template.ParseFiles(templates.Path() + "email.html")
+// immediateSubscribers returns the users and teams with a subscription that has
+// Immediate notifications for some type of activity
+func immediateSubscribers(users []github.User, teams []github.Team) ([]github.User, []github.Team, error) {
+	subscriptions, err := github.GetAllSubscriptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	userIDs := map[uint64]bool{}
+	teamIDs := map[uint]bool{}
+	for _, sub := range subscriptions {
+		if !sub.EmailPreference.Has(github.Immediate) {
+			continue
+		}
+		if sub.TeamID != 0 {
+			teamIDs[sub.TeamID] = true
+		} else {
+			userIDs[sub.UserID] = true
+		}
+	}
+	subscribedUsers := []github.User{}
+	for _, user := range users {
+		if userIDs[user.ID] {
+			subscribedUsers = append(subscribedUsers, user)
+		}
+	}
+	subscribedTeams := []github.Team{}
+	for _, team := range teams {
+		if teamIDs[team.ID] {
+			subscribedTeams = append(subscribedTeams, team)
+		}
+	}
+	return subscribedUsers, subscribedTeams, nil
+}
+
+// fetchBatch fetches the activity for the subscriptions of all users in one batch
+func fetchBatch(ctx context.Context, emailType github.Frequency) (string, error) {
+	subscriptions, err := github.GetAllSubscriptions()
 	if err != nil {
 		return "", err
 	}
+	return github.FetchBatch(ctx, source, subscriptions, emailType)
+}
+
+// fetchData gets email payloads for subscriptions from the batch if one is given,
+// and fetches them directly when there is no batch or it can't be read. Each
+// subscription's digest starts where its last digest of emailType ended.
+//
+// For scheduled digests at is the github.ScheduleTime of the cron run and payloads are
+// composed for each window due for deliveries, from the batch of the window if batch is
+// "true". Other digests end at the DigestWindow of now.
+func fetchData(ctx context.Context, subscriptions []github.Subscription,
+	emailType github.Frequency, batch string, at time.Time, now time.Time,
+	deliveries github.Deliveries) ([]github.EmailPayload, error) {
+
+	if !at.IsZero() {
+		return fetchDueData(ctx, subscriptions, emailType, batch == "true", at, deliveries)
+	}
+	return github.FetchDigestData(ctx, source, subscriptions, emailType,
+		github.DigestWindow(source, subscriptions, emailType, now), batch)
+}
+
+// fetchDueData gets email payloads for the subscriptions with a digest due at the
+// github.ScheduleTime at for deliveries, from the batch of each window with batch
+func fetchDueData(ctx context.Context, subscriptions []github.Subscription,
+	emailType github.Frequency, batch bool, at time.Time,
+	deliveries github.Deliveries) ([]github.EmailPayload, error) {
+
+	digests := github.DueDigests(subscriptions, emailType, at, deliveries)
+	return fetchDigests(ctx, digests, emailType, batch)
+}
+
+// fetchDigests gets email payloads for the subscriptions of digests up to the end of their
+// window that source has loaded, from the batch of each window with batch
+func fetchDigests(ctx context.Context, digests []github.DueDigest, emailType github.Frequency,
+	batch bool) ([]github.EmailPayload, error) {
+
+	results := []github.EmailPayload{}
+	for _, digest := range digests {
+		name := ""
+		if batch {
+			name = github.BatchName(emailType, digest.Window)
+		}
+		data, err := github.FetchDigestData(ctx, source, digest.Subscriptions, emailType,
+			digest.Window.Loaded(source, digest.Subscriptions), name)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, data...)
+	}
+	return results, nil
+}
 
-	payload := struct {
+// scheduleTime parses the at parameter of a task for scheduled digests, which is empty
+// for other digests
+func scheduleTime(at string) (time.Time, error) {
+	if at == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return github.ScheduleTime(time.Unix(seconds, 0)), nil
+}
+
+// taskTime parses the time parameter of a task, the Unix time of the cron run that added
+// it, which is the current time for tasks without one
+func taskTime(t string) (time.Time, error) {
+	if t == "" {
+		return time.Now(), nil
+	}
+	seconds, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// digestDate formats the date of a digest in loc for its subject, with the time for
+// digests that can be sent more than once a day
+func digestDate(f github.Frequency, loc *time.Location) string {
+	if f.Frequent() || f == github.Scheduled {
+		return time.Now().In(loc).Format("Jan 02,2006 3:04 PM")
+	}
+	return time.Now().In(loc).Format("Jan 02,2006")
+}
+
+// digestSubject returns the subject of the digest of frequency f sent to a user, with the
+// date in loc
+func digestSubject(f github.Frequency, loc *time.Location) string {
+	if f == github.Immediate {
+		return "New GitHub Activity at " + digestDate(f, loc)
+	}
+	return "GitHub Activity Digest for " + digestDate(f, loc)
+}
+
+// composeEmails returns the HTML and plain-text content of a digest for a user, or for a
+// team with team
+func composeEmails(user string, team bool, emailType string, data []github.Payload,
+	loc *time.Location, unsubscribe func(repo string) string) (string, string, error) {
+
+	emailContent, err := composeEmailContent(user, team, emailType, data, loc, unsubscribe)
+	if err != nil {
+		return "", "", err
+	}
+	emailText, err := composeEmailText(user, team, emailType, data, loc, unsubscribe)
+	if err != nil {
+		return "", "", err
+	}
+	return emailContent, emailText, nil
+}
+
+// composeEmailContent populates an email template with issues, with times shown in loc and
+// the links of unsubscribe
+func composeEmailContent(user string, team bool, emailType string, data []github.Payload,
+	loc *time.Location, unsubscribe func(repo string) string) (string, error) {
+
+	pageTemplate, err := template.New("email.html").Funcs(template.FuncMap{
+		"local":       localTime(loc),
+		"unsubscribe": unsubscribe,
+	}).ParseFiles(templates.Path() + "email.html")
+	if err != nil {
+		return "", err
+	}
+
+	var emailContent bytes.Buffer
+
+	err = pageTemplate.Execute(&emailContent, templateData(user, team, emailType, data))
+	if err != nil {
+		return "", err
+	}
+
+	return emailContent.String(), nil
+
+}
+
+// composeEmailText populates the plain-text email template with issues, with times shown
+// in loc and the links of unsubscribe. The lists of activity are aligned in columns and URLs
+// are listed as footnotes.
+func composeEmailText(user string, team bool, emailType string, data []github.Payload,
+	loc *time.Location, unsubscribe func(repo string) string) (string, error) {
+
+	links := []string{}
+	refs := map[string]int{}
+	pageTemplate, err := texttemplate.New("email.txt").Funcs(texttemplate.FuncMap{
+		"local": localTime(loc),
+		"cell":  textCell,
+		"join": func(names []string) string {
+			return textCell(strings.Join(names, ", "))
+		},
+		"indent":      indentText,
+		"unsubscribe": unsubscribe,
+		"ref": func(url string) string {
+			if len(url) == 0 {
+				return ""
+			}
+			if _, ok := refs[url]; !ok {
+				links = append(links, url)
+				refs[url] = len(links)
+			}
+			return fmt.Sprintf("[%d]", refs[url])
+		},
+		"footnotes": func() []string {
+			notes := []string{}
+			for i, url := range links {
+				notes = append(notes, fmt.Sprintf("[%d]\t%s", i+1, url))
+			}
+			return notes
+		},
+	}).ParseFiles(templates.Path() + "email.txt")
+	if err != nil {
+		return "", err
+	}
+
+	var emailContent bytes.Buffer
+	// Cells separated by tabs are aligned with spaces
+	w := tabwriter.NewWriter(&emailContent, 0, 0, 2, ' ', 0)
+	if err := pageTemplate.Execute(w, templateData(user, team, emailType, data)); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return emailContent.String(), nil
+}
+
+// templateData is the data of the email templates
+func templateData(user string, team bool, emailType string, data []github.Payload) interface{} {
+	return struct {
 		User  string
+		Team  bool // the digest of a team, named by User
 		Repos []github.Payload
 		Type  string
 	}{
 		user,
+		team,
 		data,
 		emailType,
 	}
-	var emailContent bytes.Buffer
+}
 
-	if err := pageTemplate.Execute(&emailContent, payload); err != nil {
-		return "", err
+// localTime returns the template function that formats times in loc
+func localTime(loc *time.Location) func(time.Time) string {
+	return func(t time.Time) string {
+		return t.In(loc).Format("Jan 02 2006 3:04 PM MST")
 	}
+}
 
-	return emailContent.String(), nil
+// textCell returns s on a single line without tabs, for a cell of the plain-text email
+func textCell(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
 
+// indentText returns the lines of s indented for the body of a comment or review in the
+// plain-text email, with tabs replaced so that they aren't aligned as cells
+func indentText(s string) string {
+	s = strings.Replace(strings.Replace(s, "\r\n", "\n", -1), "\t", "    ", -1)
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("      "+line, " ")
+	}
+	return strings.Join(lines, "\n")
 }
 
 // isEmpty checks if the payload to send an email is empty
@@ -145,7 +703,10 @@ func isEmpty(ctx context.Context, data []github.Payload) bool {
 	sum := 0
 	for _, item := range data {
 		log.Infof(ctx, "No content on:%v", item)
-		itemSum := len(item.OpenIssues) + len(item.ClosedIssues) + len(item.Comments)
+		itemSum := len(item.OpenIssues) + len(item.ClosedIssues) + len(item.Comments) +
+			len(item.OpenPulls) + len(item.MergedPulls) + len(item.ClosedPulls) +
+			len(item.ReviewRequests) + len(item.Reviews) +
+			len(item.Releases) + len(item.Forks) + item.NewStars
 		if itemSum != 0 || item.NoComment {
 			sum = sum + 1
 		}
@@ -156,17 +717,13 @@ func isEmpty(ctx context.Context, data []github.Payload) bool {
 	return false
 }
 
-// sendMail sends out an email to the receiver with the given content
-func sendMail(ctx context.Context, to string, subject string, body string) error {
+// sendMail sends out msg with the sender and reply-to address set by the MAIL_SENDER and
+// MAIL_REPLY_TO environment variables
+func sendMail(ctx context.Context, msg Message) error {
 
-	// TODO: Replace this email with one that is configured with App Engine's Mail API
-	msg := &mail.Message{
-		Sender:   "email@example.com",
-		To:       []string{to},
-		Subject:  subject,
-		HTMLBody: body,
-	}
-	if err := mail.Send(ctx, msg); err != nil {
+	msg.Sender = os.Getenv("MAIL_SENDER")
+	msg.ReplyTo = os.Getenv("MAIL_REPLY_TO")
+	if err := transport.Send(ctx, msg); err != nil {
 		log.Errorf(ctx, "Couldn't send email: %v", err)
 		return err
 	}
@@ -174,14 +731,93 @@ func sendMail(ctx context.Context, to string, subject string, body string) error
 	return nil
 }
 
-func getFrequency(email string) github.Frequency {
+// unsubscribeLinks returns the function that gives the link that unsubscribes the user
+// with userID from the subscription in subscriptions that covers a repo, or from all repos
+// for an empty repo. Links are signed with the UNSUBSCRIBE_SECRET environment variable and
+// point to UNSUBSCRIBE_URL, the backend's unsubscribe handler on App Engine by default.
+// There are no links when the secret isn't set.
+func unsubscribeLinks(ctx context.Context, userID uint64,
+	subscriptions []github.Subscription) func(repo string) string {
+
+	secret, base := unsubscribeURL(ctx)
+	if len(secret) == 0 {
+		return noLinks
+	}
+	return func(repo string) string {
+		if len(repo) != 0 {
+			var ok bool
+			if repo, ok = github.SubscribedRepo(subscriptions, repo); !ok {
+				return ""
+			}
+		}
+		return base + "?token=" + url.QueryEscape(github.UnsubscribeToken(secret, userID, repo))
+	}
+}
+
+// leaveTeamLinks returns the function that gives the link that removes the member of team
+// with the address to from the team for an empty repo, like unsubscribeLinks. There are no
+// links to repos, which are subscribed by the owners of the team, no links for the
+// mailing list of a team and no links for its only owner, who can't leave it.
+func leaveTeamLinks(ctx context.Context, team github.Team, to string) func(repo string) string {
+	secret, base := unsubscribeURL(ctx)
+	if len(secret) == 0 || len(team.Email) != 0 {
+		return noLinks
+	}
+	for _, m := range team.Members {
+		if len(to) != 0 && m.User.Email == to && !team.LastOwner(m.User) {
+			link := base + "?token=" + url.QueryEscape(github.LeaveTeamToken(secret, m.UserID, team.ID))
+			return func(repo string) string {
+				if len(repo) != 0 {
+					return ""
+				}
+				return link
+			}
+		}
+	}
+	return noLinks
+}
+
+// unsubscribeURL returns the UNSUBSCRIBE_SECRET that signs unsubscribe links and the
+// UNSUBSCRIBE_URL that they point to
+func unsubscribeURL(ctx context.Context) (string, string) {
+	base := os.Getenv("UNSUBSCRIBE_URL")
+	if len(base) == 0 {
+		base = "https://" + appengine.AppID(ctx) + ".appspot.com/api/unsubscribe"
+	}
+	return os.Getenv("UNSUBSCRIBE_SECRET"), base
+}
+
+// noLinks gives no unsubscribe links
+func noLinks(repo string) string {
+	return ""
+}
+
+// Frequency returns the frequency of the type of email with the given name, such as
+// "weekly", and false for unknown names
+func Frequency(email string) (github.Frequency, bool) {
 	switch email {
 	case "daily":
-		return github.Daily
+		return github.Daily, true
 	case "weekly":
-		return github.Weekly
+		return github.Weekly, true
 	case "monthly":
-		return github.Monthly
+		return github.Monthly, true
+	case "immediate":
+		return github.Immediate, true
+	case "hourly":
+		return github.Hourly, true
+	case "twicedaily":
+		return github.TwiceDaily, true
+	case "scheduled":
+		return github.Scheduled, true
+	}
+	return 0, false
+}
+
+// getFrequency returns the frequency of the type of email, Daily for unknown names
+func getFrequency(email string) github.Frequency {
+	if f, ok := Frequency(email); ok {
+		return f
 	}
 	return github.Daily
 }
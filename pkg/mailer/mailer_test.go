@@ -111,7 +111,12 @@ func TestSendMail(t *testing.T) {
 	req, err := inst.NewRequest("GET", "/daily", nil)
 	ctx := appengine.NewContext(req)
 
-	err = sendMail(ctx, "testing@example.com", "TestEmailSubject", "TestMailBody")
+	err = sendMail(ctx, Message{
+		To:       []string{"testing@example.com"},
+		Subject:  "TestEmailSubject",
+		TextBody: "TestMailText",
+		HTMLBody: "TestMailBody",
+	})
 	if err != nil {
 		t.Errorf("sendMail() failed with error: %v", err)
 	}
@@ -0,0 +1,82 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+
+	"golang.org/x/net/context"
+)
+
+// Digest is a rendered digest email
+type Digest struct {
+	Email   string // address the digest is sent to
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// PreviewDigests fetches the activity for the digests of emailType, such as "weekly", that
+// the user would get so far and renders them, without sending them or recording
+// notifications. Like the digests of the mailer, each one starts where the last digest of
+// the subscription ended, or at the last time of its schedule, and ends at the activity
+// that the EVENT_SOURCE has loaded.
+func PreviewDigests(ctx context.Context, user github.User, emailType string) ([]Digest, error) {
+	emailFrequency, ok := Frequency(emailType)
+	if !ok {
+		return nil, fmt.Errorf("Invalid frequency: %q", emailType)
+	}
+	delivery := user.Delivery()
+	results, err := previewData(ctx, user.Subscriptions, emailFrequency, time.Now(),
+		github.Deliveries{user.ID: delivery})
+	if err != nil {
+		return nil, err
+	}
+	unsubscribe := unsubscribeLinks(ctx, user.ID, user.Subscriptions)
+	digests := []Digest{}
+	for _, data := range results {
+		if isEmpty(ctx, data.Content) {
+			continue
+		}
+		emailContent, emailText, err := composeEmails(user.Login, false, emailType, data.Content,
+			delivery.Location, unsubscribe)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, Digest{
+			Email:   data.Email,
+			Subject: digestSubject(emailFrequency, delivery.Location),
+			HTML:    emailContent,
+			Text:    emailText,
+		})
+	}
+	return digests, nil
+}
+
+// previewData gets email payloads for the digests of emailType that are pending at now for
+// the subscriptions, or for the immediate notifications that the mailer would send now
+func previewData(ctx context.Context, subscriptions []github.Subscription,
+	emailType github.Frequency, now time.Time,
+	deliveries github.Deliveries) ([]github.EmailPayload, error) {
+
+	if emailType == github.Immediate {
+		return fetchData(ctx, subscriptions, emailType, "", time.Time{}, now, deliveries)
+	}
+	digests := github.PendingDigests(subscriptions, emailType, now, deliveries)
+	return fetchDigests(ctx, digests, emailType, false)
+}
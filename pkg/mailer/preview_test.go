@@ -0,0 +1,35 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailer
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+)
+
+func TestFrequency(t *testing.T) {
+	for _, name := range scheduledTypes {
+		if f, ok := Frequency(name); !ok || getFrequency(name) != f {
+			t.Errorf("Frequency(%q) got %v, %v, wanted a known frequency", name, f, ok)
+		}
+	}
+	if f, ok := Frequency("yearly"); ok {
+		t.Errorf("Frequency(%q) got %v, wanted an unknown frequency", "yearly", f)
+	}
+	if f := getFrequency("yearly"); f != github.Daily {
+		t.Errorf("getFrequency(%q) got %v, wanted Daily", "yearly", f)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/issuetracker/pkg/github"
+)
+
+func TestComposeEmailText(t *testing.T) {
+	created := time.Date(2017, 8, 11, 12, 0, 0, 0, time.UTC)
+	data := []github.Payload{{
+		RepoName: "GoogleCloudPlatform/issuetracker",
+		OpenIssues: []github.Issue{
+			{Number: 7, Title: "Short", URL: "https://github.com/i/7", Created: created},
+			{Number: 1234, Title: "A\tlonger title", URL: "https://github.com/i/1234",
+				Created: created, Assignees: github.Names{"alice", "bob"}},
+		},
+		Comments: []github.Comment{
+			{Author: "carol", IssueID: "7", Body: "Looks good.\r\nShip it", URL: "https://github.com/i/7",
+				Created: created},
+		},
+	}}
+	text, err := composeEmailText("test", false, "daily", data, time.UTC, noLinks)
+	if err != nil {
+		t.Fatalf("composeEmailText() failed: %v", err)
+	}
+	for _, want := range []string{
+		"Hello test\n",
+		"== Activity on GoogleCloudPlatform/issuetracker ==\n",
+		"  #7     Short           Aug 11 2017 12:00 PM UTC  unassigned              [1]\n",
+		"  #1234  A longer title  Aug 11 2017 12:00 PM UTC  assigned to alice, bob  [2]\n",
+		"  carol commented on #7 at Aug 11 2017 12:00 PM UTC [1]\n      Looks good.\n      Ship it\n",
+		"Links:\n  [1]  https://github.com/i/7\n  [2]  https://github.com/i/1234\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("composeEmailText() got:\n%s\nwanted it to contain:\n%s", text, want)
+		}
+	}
+}
+
+func TestComposeEmailTextUnsubscribe(t *testing.T) {
+	data := []github.Payload{{RepoName: "GoogleCloudPlatform/issuetracker", NewStars: 2}}
+	unsubscribe := func(repo string) string {
+		return "https://example.com/api/unsubscribe?repo=" + repo
+	}
+	text, err := composeEmailText("test", false, "daily", data, time.UTC, unsubscribe)
+	if err != nil {
+		t.Fatalf("composeEmailText() failed: %v", err)
+	}
+	for _, want := range []string{
+		"Unsubscribe from this repo: [1]\n",
+		"  [1]  https://example.com/api/unsubscribe?repo=GoogleCloudPlatform/issuetracker\n",
+		"Unsubscribe from all repos: https://example.com/api/unsubscribe?repo=\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("composeEmailText() got:\n%s\nwanted it to contain:\n%s", text, want)
+		}
+	}
+}
+
+func TestComposeEmailTextLeaveTeam(t *testing.T) {
+	data := []github.Payload{{RepoName: "GoogleCloudPlatform/issuetracker", NewStars: 2}}
+	leave := func(repo string) string {
+		if len(repo) != 0 {
+			return ""
+		}
+		return "https://example.com/api/unsubscribe?team=1"
+	}
+	text, err := composeEmailText("myteam", true, "daily", data, time.UTC, leave)
+	if err != nil {
+		t.Fatalf("composeEmailText() failed: %v", err)
+	}
+	want := "Leave the team myteam: https://example.com/api/unsubscribe?team=1\n"
+	if !strings.Contains(text, want) {
+		t.Errorf("composeEmailText() got:\n%s\nwanted it to contain:\n%s", text, want)
+	}
+	if strings.Contains(text, "Unsubscribe") {
+		t.Errorf("composeEmailText() got:\n%s\nwanted no unsubscribe links", text)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	aemail "google.golang.org/appengine/mail"
+)
+
+// Names of the transports that can be set with the MAIL_TRANSPORT environment variable
+const (
+	TransportAppEngine = "appengine" // App Engine Mail API
+	TransportSMTP      = "smtp"      // SMTP server
+	TransportFile      = "file"      // maildir on the local filesystem
+)
+
+// Message is an email sent by a Transport
+type Message struct {
+	Sender   string // address of the sender, the transport's default if empty
+	ReplyTo  string // address for replies, none if empty
+	To       []string
+	Subject  string
+	TextBody string // plain-text alternative of HTMLBody, none if empty
+	HTMLBody string
+	// URL that unsubscribes the recipient with a POST request, for the RFC 8058
+	// List-Unsubscribe headers, none if empty
+	ListUnsubscribe string
+}
+
+// Transport sends emails
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewTransport returns the Transport with the given name, configured by environment
+// variables. App Engine mail is used by default.
+//
+// SMTP is configured by SMTP_ADDR as host:port, and optionally by SMTP_USERNAME and
+// SMTP_PASSWORD. The file transport writes to the maildir in MAIL_DIR, "mail" by default.
+func NewTransport(name string) Transport {
+	switch name {
+	case TransportSMTP:
+		return SMTPTransport{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case TransportFile:
+		dir := os.Getenv("MAIL_DIR")
+		if len(dir) == 0 {
+			dir = "mail"
+		}
+		return FileTransport{Dir: dir}
+	}
+	return AppEngineTransport{}
+}
+
+// AppEngineTransport sends emails with the App Engine Mail API
+type AppEngineTransport struct{}
+
+// Send sends msg with the App Engine Mail API, from the app's noreply address if msg has
+// no sender
+func (AppEngineTransport) Send(ctx context.Context, msg Message) error {
+	sender := msg.Sender
+	if len(sender) == 0 {
+		sender = "noreply@" + appengine.AppID(ctx) + ".appspotmail.com"
+	}
+	m := &aemail.Message{
+		Sender:   sender,
+		ReplyTo:  msg.ReplyTo,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Body:     msg.TextBody,
+		HTMLBody: msg.HTMLBody,
+	}
+	if len(msg.ListUnsubscribe) != 0 {
+		// The Mail API doesn't allow List-Unsubscribe-Post, so clients open the link
+		m.Headers = mail.Header{"List-Unsubscribe": {"<" + msg.ListUnsubscribe + ">"}}
+	}
+	return aemail.Send(ctx, m)
+}
+
+// SMTPTransport sends emails through an SMTP server, with STARTTLS when the server
+// supports it. Messages are authenticated with PLAIN auth when Username is set, which
+// requires TLS unless the server is on localhost.
+type SMTPTransport struct {
+	Addr     string // host:port of the server
+	Username string
+	Password string
+}
+
+// Send sends msg through the SMTP server
+func (t SMTPTransport) Send(ctx context.Context, msg Message) error {
+	if len(msg.Sender) == 0 {
+		return fmt.Errorf("Failed to send email, no sender")
+	}
+	host, _, err := net.SplitHostPort(t.Addr)
+	if err != nil {
+		return fmt.Errorf("Failed to send email, invalid SMTP address %q: %v", t.Addr, err)
+	}
+	data, err := msg.bytes(time.Now())
+	if err != nil {
+		return err
+	}
+	c, err := smtp.Dial(t.Addr)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to %s: %v", t.Addr, err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("Failed to start TLS with %s: %v", t.Addr, err)
+		}
+	}
+	if len(t.Username) != 0 {
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, host)); err != nil {
+			return fmt.Errorf("Failed to authenticate with %s: %v", t.Addr, err)
+		}
+	}
+	if err := c.Mail(address(msg.Sender)); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(address(to)); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileTransport writes emails to a maildir instead of sending them, for local development
+// and tests. Each message is a file in the "new" directory of Dir.
+type FileTransport struct {
+	Dir string
+}
+
+// deliveries numbers the files written by FileTransport so that their names are unique
+var deliveries uint64
+
+// Send writes msg to a file in the maildir, which is created if needed
+func (t FileTransport) Send(ctx context.Context, msg Message) error {
+	data, err := msg.bytes(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0755); err != nil {
+			return fmt.Errorf("Failed to create maildir %s: %v", t.Dir, err)
+		}
+	}
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().Unix(), os.Getpid(),
+		atomic.AddUint64(&deliveries, 1), strings.Replace(host, "/", "_", -1))
+	// Messages are written to tmp and moved to new, so that readers only see whole messages
+	tmp := filepath.Join(t.Dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("Failed to write email: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(t.Dir, "new", name)); err != nil {
+		return fmt.Errorf("Failed to write email: %v", err)
+	}
+	return nil
+}
+
+// Messages returns the emails in the maildir, oldest first
+func (t FileTransport) Messages() ([]*mail.Message, error) {
+	files, err := ioutil.ReadDir(filepath.Join(t.Dir, "new"))
+	if err != nil {
+		return nil, err
+	}
+	// ReadDir sorts by name, which starts with the time of the message
+	messages := []*mail.Message{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(t.Dir, "new", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, err := mail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read email %s: %v", f.Name(), err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// address returns the address part of addr, which can have a name such as
+// "Digests <digests@example.com>"
+func address(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		return a.Address
+	}
+	return addr
+}
+
+// bytes returns msg formatted as an email sent at t. With a TextBody the email is a
+// multipart/alternative message of the text and HTML bodies, which are quoted-printable.
+func (m Message) bytes(t time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	header := func(key string, value string) {
+		if len(value) != 0 {
+			fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+		}
+	}
+	header("From", m.Sender)
+	header("Reply-To", m.ReplyTo)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", t.Format(time.RFC1123Z))
+	if len(m.ListUnsubscribe) != 0 {
+		header("List-Unsubscribe", "<"+m.ListUnsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	header("MIME-Version", "1.0")
+	if len(m.TextBody) == 0 {
+		header("Content-Type", "text/html; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		if err := writeQuotedPrintable(&b, m.HTMLBody); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	w := multipart.NewWriter(&b)
+	header("Content-Type", "multipart/alternative; boundary="+w.Boundary())
+	b.WriteString("\r\n")
+	// Clients show the last part they support, so the HTML body comes last
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", m.TextBody},
+		{"text/html; charset=UTF-8", m.HTMLBody},
+	}
+	for _, p := range parts {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode email: %v", err)
+		}
+		if err := writeQuotedPrintable(part, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Failed to encode email: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// writeQuotedPrintable writes body to w with the quoted-printable encoding
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return fmt.Errorf("Failed to encode email: %v", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("Failed to encode email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatalf("Failed to create maildir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	transport := FileTransport{Dir: dir}
+	msg := Message{
+		Sender:   "Digests <digests@example.com>",
+		ReplyTo:  "team@example.com",
+		To:       []string{"test@foo.com"},
+		Subject:  "GitHub Activity Digest for Aug 11 – ünïcode",
+		HTMLBody: "<p>" + strings.Repeat("Hällo ", 30) + "</p>",
+	}
+	for i := 0; i < 2; i++ {
+		if err := transport.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+	messages, err := transport.Messages()
+	if err != nil {
+		t.Fatalf("Messages() failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Messages() got %d emails, wanted 2", len(messages))
+	}
+	m := messages[0]
+	for key, want := range map[string]string{
+		"From":     msg.Sender,
+		"Reply-To": msg.ReplyTo,
+		"To":       "test@foo.com",
+	} {
+		if got := m.Header.Get(key); got != want {
+			t.Errorf("Messages() got %s %q, wanted %q", key, got, want)
+		}
+	}
+	if got, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject")); got != msg.Subject {
+		t.Errorf("Messages() got subject %q, wanted %q", got, msg.Subject)
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil || string(body) != msg.HTMLBody {
+		t.Errorf("Messages() got body %q, wanted %q: %v", body, msg.HTMLBody, err)
+	}
+}
+
+func TestMultipartMessage(t *testing.T) {
+	msg := Message{
+		Sender:   "digests@example.com",
+		To:       []string{"test@foo.com"},
+		Subject:  "GitHub Activity Digest",
+		TextBody: "Hello test",
+		HTMLBody: "<h3>Hello test</h3>",
+
+		ListUnsubscribe: "https://example.com/api/unsubscribe?token=abc",
+	}
+	data, err := msg.bytes(time.Now())
+	if err != nil {
+		t.Fatalf("bytes() failed: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("bytes() got an invalid email: %v", err)
+	}
+	for key, want := range map[string]string{
+		"List-Unsubscribe":      "<https://example.com/api/unsubscribe?token=abc>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	} {
+		if got := m.Header.Get(key); got != want {
+			t.Errorf("bytes() got %s %q, wanted %q", key, got, want)
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("bytes() got Content-Type %q, wanted multipart/alternative",
+			m.Header.Get("Content-Type"))
+	}
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.TextBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for _, w := range want {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("bytes() got too few parts: %v", err)
+		}
+		// The multipart reader decodes quoted-printable parts
+		body, err := ioutil.ReadAll(part)
+		if err != nil || string(body) != w.body {
+			t.Errorf("bytes() got body %q, wanted %q: %v", body, w.body, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType {
+			t.Errorf("bytes() got Content-Type %q, wanted %q", got, w.contentType)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("bytes() got more than 2 parts")
+	}
+}
@@ -34,6 +34,12 @@ func registerHandlers() {
 	// Endpoint for debugging - requires admin access
 	r.Methods("GET").Path("/debug/{id}").Handler(backend.GetHandler(backend.UserGet))
 
+	// Endpoint for BigQuery usage reports - requires admin access
+	r.Methods("GET").Path("/admin/usage").Handler(backend.GetHandler(backend.QueryUsage))
+
+	// Endpoint for GitHub webhooks - verified by signature
+	r.Methods("POST").Path("/webhooks/github").Handler(backend.GetHandler(backend.GitHubWebhook))
+
 	api := r.PathPrefix("/api/").Subrouter()
 
 	// Auth API
@@ -44,12 +50,31 @@ func registerHandlers() {
 	api.Methods("POST").Path("/subscriptions/add").Handler(backend.GetHandler(backend.AddSubs))
 	api.Methods("POST").Path("/subscriptions/update").Handler(backend.GetHandler(backend.UpdateSub))
 	api.Methods("POST").Path("/subscriptions/remove").Handler(backend.GetHandler(backend.DelSubs))
+	api.Methods("GET").Path("/subscriptions/import").Handler(backend.GetHandler(backend.ImportCandidates))
+	api.Methods("POST").Path("/subscriptions/import").Handler(backend.GetHandler(backend.ImportSubs))
 
 	// User API
 	api.Methods("GET").Path("/users/repos").Handler(backend.GetHandler(backend.GetRepos))
 	api.Methods("POST").Path("/users/add").Handler(backend.GetHandler(backend.UserAdd))
 	api.Methods("POST").Path("/users/update").Handler(backend.GetHandler(backend.UserUpdate))
 
+	// Team API
+	api.Methods("GET").Path("/teams").Handler(backend.GetHandler(backend.GetTeams))
+	api.Methods("POST").Path("/teams/add").Handler(backend.GetHandler(backend.AddTeam))
+	api.Methods("POST").Path("/teams/update").Handler(backend.GetHandler(backend.UpdateTeam))
+	api.Methods("POST").Path("/teams/remove").Handler(backend.GetHandler(backend.DelTeam))
+	api.Methods("POST").Path("/teams/members/add").Handler(backend.GetHandler(backend.AddTeamMember))
+	api.Methods("POST").Path("/teams/members/remove").Handler(backend.GetHandler(backend.DelTeamMember))
+	api.Methods("POST").Path("/teams/subscriptions/add").Handler(backend.GetHandler(backend.AddTeamSubs))
+	api.Methods("POST").Path("/teams/subscriptions/update").Handler(backend.GetHandler(backend.UpdateTeamSub))
+	api.Methods("POST").Path("/teams/subscriptions/remove").Handler(backend.GetHandler(backend.DelTeamSubs))
+
+	// Unsubscribe links of digests - verified by signature
+	api.Methods("GET", "POST").Path("/unsubscribe").Handler(backend.GetHandler(backend.Unsubscribe))
+
+	// Digest API
+	api.Methods("GET").Path("/digest/preview").Handler(backend.GetHandler(backend.DigestPreview))
+
 	// Notifications API
 	api.Methods("GET").Path("/notifications").Handler(backend.GetHandler(backend.GetNotifications))
 
@@ -65,6 +90,7 @@ func registerHandlers() {
 
 	// Route all requests through the Mux and add CSRF protection
 	http.Handle("/api/", r)
+	http.Handle("/webhooks/", r)
 
 	// Prevent unauthorised requests to backend server
 	http.Handle("/", auth.RequireAdmin{r})
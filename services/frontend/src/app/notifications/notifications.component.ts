@@ -155,6 +155,22 @@ export class NotificationDatabase {
         kind = "monthly"
         break;
       }
+      case 5: {
+        kind = "immediate"
+        break;
+      }
+      case 6: {
+        kind = "hourly"
+        break;
+      }
+      case 7: {
+        kind = "twice daily"
+        break;
+      }
+      case 8: {
+        kind = "scheduled"
+        break;
+      }
     }
     let options = {
         weekday: 'long',
@@ -28,6 +28,8 @@ export class PreferencesComponent implements OnInit {
 
 
   defaultEmail: string
+  timezone: string
+  deliveryHour: number
   userData: JSON
 
   @ViewChild('preferenceForm') prefForm: NgForm;
@@ -45,6 +47,8 @@ export class PreferencesComponent implements OnInit {
   setUserData(data){
     this.userData = data
     this.defaultEmail = data["Email"]
+    this.timezone = data["Timezone"]
+    this.deliveryHour = data["DeliveryHour"]
   }
 
   onSubmit(){
@@ -53,6 +57,8 @@ export class PreferencesComponent implements OnInit {
       user.getIdToken().then(token=>{
         var formData = new FormData()
         formData.append("email",this.defaultEmail)
+        formData.append("timezone",this.timezone || "")
+        formData.append("deliveryHour",String(this.deliveryHour))
         var result = fetch('/api/users/update',{
           method:'POST',
           headers:{
@@ -67,6 +73,8 @@ export class PreferencesComponent implements OnInit {
               duration: 2000,
             });
             this.userData["Email"] = this.defaultEmail
+            this.userData["Timezone"] = this.timezone
+            this.userData["DeliveryHour"] = this.deliveryHour
             this.userEmitter.saveData(this.userData)
             this.prefForm.form.markAsPristine()
           }
@@ -50,6 +50,15 @@ import {UserDataService} from '../misc/services'
       public IssueReopen: number,
       public NewComment:  number,
       public NoComment:   number,
+      public PullOpen:          number,
+      public PullMerge:         number,
+      public PullClose:         number,
+      public PullReviewRequest: number,
+      public PullReview:        number,
+      public PullReviewComment: number,
+      public Release: number,
+      public Star:    number,
+      public Fork:    number,
     ){}
   }
 
@@ -67,9 +76,12 @@ import {UserDataService} from '../misc/services'
       {view:"Daily",value:2},
       {view:"Weekly",value:3},
       {view:"Monthly",value:4},
+      {view:"Immediate",value:5},
+      {view:"Hourly",value:6},
+      {view:"Twice daily",value:7},
     ]
     // Default preferences
-    settings = new Settings(2,2,2,2,2)
+    settings = new Settings(2,2,2,2,2,2,2,2,2,2,2,2,2,2)
     defaultEmail = ""
     repo: string
     private storedPreference:any
@@ -106,7 +118,16 @@ import {UserDataService} from '../misc/services'
           data["IssueClose"],
           data["IssueReopen"],
           data["NewComment"],
-          data["NoComment"]
+          data["NoComment"],
+          data["PullOpen"],
+          data["PullMerge"],
+          data["PullClose"],
+          data["PullReviewRequest"],
+          data["PullReview"],
+          data["PullReviewComment"],
+          data["Release"],
+          data["Star"],
+          data["Fork"]
         )
     }
 
@@ -117,6 +138,15 @@ import {UserDataService} from '../misc/services'
       this.storedPreference["IssueReopen"] = data["IssueReopen"];
       this.storedPreference["NewComment"] = data["NewComment"];
       this.storedPreference["NoComment"] = data["NoComment"];
+      this.storedPreference["PullOpen"] = data["PullOpen"];
+      this.storedPreference["PullMerge"] = data["PullMerge"];
+      this.storedPreference["PullClose"] = data["PullClose"];
+      this.storedPreference["PullReviewRequest"] = data["PullReviewRequest"];
+      this.storedPreference["PullReview"] = data["PullReview"];
+      this.storedPreference["PullReviewComment"] = data["PullReviewComment"];
+      this.storedPreference["Release"] = data["Release"];
+      this.storedPreference["Star"] = data["Star"];
+      this.storedPreference["Fork"] = data["Fork"];
     }
 
     onSubmit() {